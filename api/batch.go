@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+const ndjsonType = "application/x-ndjson"
+
+// BatchItem is the outcome of one user of a batch, with the status code and
+// error it would get from POST /users.
+type BatchItem struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`
+	User   *logic.User `json:"user,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchItem `json:"results"`
+	Created int         `json:"created"`
+	Failed  int         `json:"failed"`
+}
+
+// decodeBatch reads users from a JSON array or, with Content-Type
+// application/x-ndjson, from one JSON object per line.
+func decodeBatch(r *http.Request) ([]logic.User, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	dec := json.NewDecoder(r.Body)
+	if mediaType != ndjsonType {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok != json.Delim('[') {
+			return nil, errors.New("batch must be a JSON array")
+		}
+	}
+	var users []logic.User
+	for mediaType == ndjsonType || dec.More() {
+		var user logic.User
+		if err := dec.Decode(&user); err != nil {
+			if errors.Is(err, io.EOF) && mediaType == ndjsonType {
+				break
+			}
+			return nil, fmt.Errorf("decoding user %d: %w", len(users), err)
+		}
+		// Checked once another user is decoded, as NDJSON with exactly
+		// MaxBatchSize users only ends with EOF.
+		if len(users) == logic.MaxBatchSize {
+			return nil, fmt.Errorf("batch must have at most %d users", logic.MaxBatchSize)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func toBatchResponse(results []logic.BatchResult) BatchResponse {
+	res := BatchResponse{Results: make([]BatchItem, len(results))}
+	for i, result := range results {
+		item := BatchItem{Index: i, Status: http.StatusCreated, User: result.User}
+		if result.Err != nil {
+			item.Status = getStatusCode(result.Err)
+			item.Error = result.Err.Error()
+			res.Failed++
+		} else {
+			res.Created++
+		}
+		res.Results[i] = item
+	}
+	return res
+}
+
+// batchStatusCode is 201 when every user is created and 207 Multi-Status
+// when some failed, see the status of each item.
+func batchStatusCode(res BatchResponse) int {
+	if res.Failed > 0 {
+		return http.StatusMultiStatus
+	}
+	return http.StatusCreated
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_decodeBatch(t *testing.T) {
+	tests := []struct {
+		name             string
+		givenContentType string
+		givenBody        string
+		expectedUsers    []logic.User
+		expectedErr      bool
+	}{
+		{
+			name:             "json array",
+			givenContentType: "application/json",
+			givenBody:        `[{"name": "kapitan"}, {"name": "porucznik", "other": "x"}]`,
+			expectedUsers:    []logic.User{{Name: "kapitan"}, {Name: "porucznik", Other: "x"}},
+		},
+		{
+			name:             "ndjson",
+			givenContentType: "application/x-ndjson; charset=utf-8",
+			givenBody:        "{\"name\": \"kapitan\"}\n{\"name\": \"porucznik\"}\n",
+			expectedUsers:    []logic.User{{Name: "kapitan"}, {Name: "porucznik"}},
+		},
+		{
+			name:             "empty ndjson",
+			givenContentType: "application/x-ndjson",
+			givenBody:        "",
+		},
+		{
+			name:             "not an array",
+			givenContentType: "application/json",
+			givenBody:        `{"name": "kapitan"}`,
+			expectedErr:      true,
+		},
+		{
+			name:             "malformed line",
+			givenContentType: "application/x-ndjson",
+			givenBody:        "{\"name\": \"kapitan\"}\nkapitan\n",
+			expectedErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/users:batch", strings.NewReader(tt.givenBody))
+			r.Header.Set("Content-Type", tt.givenContentType)
+			got, err := decodeBatch(r)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("decodeBatch() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if !tt.expectedErr && !reflect.DeepEqual(got, tt.expectedUsers) {
+				t.Errorf("decodeBatch() = %+v, want %+v", got, tt.expectedUsers)
+			}
+		})
+	}
+}
+
+func Test_decodeBatch_MaxBatchSize(t *testing.T) {
+	line := "{\"name\": \"kapitan\"}\n"
+	tests := []struct {
+		name             string
+		givenContentType string
+		givenBody        string
+		expectedErr      bool
+	}{
+		{"ndjson at limit", ndjsonType, strings.Repeat(line, logic.MaxBatchSize), false},
+		{"ndjson over limit", ndjsonType, strings.Repeat(line, logic.MaxBatchSize+1), true},
+		{"json array at limit", "application/json", "[" + strings.Repeat(`{"name": "kapitan"},`, logic.MaxBatchSize-1) + `{"name": "kapitan"}]`, false},
+		{"json array over limit", "application/json", "[" + strings.Repeat(`{"name": "kapitan"},`, logic.MaxBatchSize) + `{"name": "kapitan"}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/users:batch", strings.NewReader(tt.givenBody))
+			r.Header.Set("Content-Type", tt.givenContentType)
+			got, err := decodeBatch(r)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("decodeBatch() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if !tt.expectedErr && len(got) != logic.MaxBatchSize {
+				t.Errorf("decodeBatch() decoded %d users, want %d", len(got), logic.MaxBatchSize)
+			}
+		})
+	}
+}
+
+func Test_toBatchResponse(t *testing.T) {
+	user := &logic.User{ID: 1, Name: "kapitan"}
+	got := toBatchResponse([]logic.BatchResult{
+		{User: user},
+		{Err: logic.ErrUserAlreadyExists},
+		{Err: logic.ErrBatchAborted},
+	})
+	expected := BatchResponse{
+		Results: []BatchItem{
+			{Index: 0, Status: 201, User: user},
+			{Index: 1, Status: 409, Error: logic.ErrUserAlreadyExists.Error()},
+			{Index: 2, Status: 424, Error: logic.ErrBatchAborted.Error()},
+		},
+		Created: 1,
+		Failed:  2,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("toBatchResponse() = %+v, want %+v", got, expected)
+	}
+	if code := batchStatusCode(got); code != 207 {
+		t.Errorf("batchStatusCode() = %v, want 207", code)
+	}
+}
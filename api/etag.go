@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+// etag formats a user version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// getPrecondition parses If-Match, nil when it is not sent. Weak and
+// malformed tags never match, as If-Match uses strong comparison.
+func getPrecondition(r *http.Request) *logic.Precondition {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return nil
+	}
+	pre := &logic.Precondition{}
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				pre.Any = true
+				continue
+			}
+			if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+				continue
+			}
+			if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+				pre.Versions = append(pre.Versions, version)
+			}
+		}
+	}
+	return pre
+}
+
+// handleUserResult writes user with its version as ETag.
+func handleUserResult(w http.ResponseWriter, code int, user *logic.User) {
+	w.Header().Set("ETag", etag(user.Version))
+	handleResult(w, code, user)
+}
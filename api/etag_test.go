@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_getPrecondition(t *testing.T) {
+	tests := []struct {
+		name                 string
+		givenIfMatch         []string
+		expectedPrecondition *logic.Precondition
+	}{
+		{
+			name:                 "no header",
+			expectedPrecondition: nil,
+		},
+		{
+			name:                 "any",
+			givenIfMatch:         []string{"*"},
+			expectedPrecondition: &logic.Precondition{Any: true},
+		},
+		{
+			name:                 "list of tags",
+			givenIfMatch:         []string{`"3", "4"`, `"5"`},
+			expectedPrecondition: &logic.Precondition{Versions: []int64{3, 4, 5}},
+		},
+		{
+			name:                 "weak and malformed tags",
+			givenIfMatch:         []string{`W/"3", 4, "x"`},
+			expectedPrecondition: &logic.Precondition{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/users/1", nil)
+			for _, v := range tt.givenIfMatch {
+				r.Header.Add("If-Match", v)
+			}
+			if got := getPrecondition(r); !reflect.DeepEqual(got, tt.expectedPrecondition) {
+				t.Errorf("getPrecondition() = %+v, want %+v", got, tt.expectedPrecondition)
+			}
+		})
+	}
+}
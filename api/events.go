@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmcszk/user-service/logging"
+	"github.com/bmcszk/user-service/outbox"
+)
+
+const eventStreamType = "text/event-stream"
+
+// heartbeatInterval is how often an idle stream sends a comment, so that
+// proxies keep the connection open and dead clients are noticed.
+const heartbeatInterval = 15 * time.Second
+
+// retryInterval is sent to clients as the delay before reconnecting.
+const retryInterval = 3 * time.Second
+
+// resumeBatch is how many missed events are read at once on resume.
+const resumeBatch = 500
+
+type eventStream interface {
+	Subscribe() (<-chan outbox.Event, func(), error)
+	EventsAfter(ctx context.Context, position int64, limit int32) ([]outbox.Event, error)
+}
+
+// getLastEventID returns the position of the last event a reconnecting
+// client received, from the Last-Event-ID header or the last_event_id param
+// for clients that cannot set headers. Zero means no resume.
+func getLastEventID(r *http.Request) (int64, error) {
+	param := r.Header.Get("Last-Event-ID")
+	if param == "" {
+		param = r.URL.Query().Get("last_event_id")
+	}
+	if param == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("parsing last event id %q", param)
+	}
+	return id, nil
+}
+
+// writeEvent writes an event in the server-sent events format with its
+// position as event id.
+func writeEvent(w io.Writer, event outbox.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Position, event.Type, data)
+	return err
+}
+
+// streamEvents streams user events as server-sent events until the client
+// disconnects, the server shuts down or the stream drops the subscriber,
+// when the client reconnects with Last-Event-ID and resumes. Events after
+// the last event position are sent first, live events already sent with
+// them are skipped.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	position, err := getLastEventID(r)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	events, unsubscribe, err := h.events.Subscribe()
+	if errors.Is(err, outbox.ErrStreamUnavailable) {
+		handleStatusError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		handleStatusError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer unsubscribe()
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", eventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", retryInterval.Milliseconds()); err != nil {
+		return
+	}
+	for position > 0 {
+		missed, err := h.events.EventsAfter(r.Context(), position, resumeBatch)
+		if err != nil {
+			logging.FromContext(r.Context()).With("error", err).Error("resuming event stream")
+			return
+		}
+		for _, event := range missed {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			position = event.Position
+		}
+		if len(missed) < resumeBatch {
+			break
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Position <= position {
+				continue
+			}
+			position = event.Position
+			err = writeEvent(w, event)
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bmcszk/user-service/outbox"
+)
+
+// fakeStream has events after position 1, committed in reverse id order,
+// and sends live events, then drops the subscriber.
+type fakeStream struct {
+	live []outbox.Event
+	err  error
+}
+
+func (s fakeStream) Subscribe() (<-chan outbox.Event, func(), error) {
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	ch := make(chan outbox.Event, len(s.live))
+	for _, event := range s.live {
+		ch <- event
+	}
+	close(ch)
+	return ch, func() {}, nil
+}
+
+func (s fakeStream) EventsAfter(ctx context.Context, position int64, limit int32) ([]outbox.Event, error) {
+	var events []outbox.Event
+	for p := position + 1; p <= 3; p++ {
+		events = append(events, outbox.Event{ID: 10 - p, Position: p, Type: "user.updated", Payload: []byte(`{}`)})
+	}
+	return events, nil
+}
+
+func Test_streamEvents(t *testing.T) {
+	live := []outbox.Event{
+		{ID: 7, Position: 3, Type: "user.updated", Payload: []byte(`{}`)},
+		{ID: 11, Position: 4, Type: "user.deleted", Payload: []byte(`{}`)},
+	}
+	tests := []struct {
+		name         string
+		stream       fakeStream
+		lastEventID  string
+		expectedCode int
+		expectedIDs  []string
+	}{
+		{
+			name:         "live",
+			stream:       fakeStream{live: live},
+			expectedCode: http.StatusOK,
+			expectedIDs:  []string{"3", "4"},
+		},
+		{
+			name:         "resumed",
+			stream:       fakeStream{live: live},
+			lastEventID:  "1",
+			expectedCode: http.StatusOK,
+			expectedIDs:  []string{"2", "3", "4"},
+		},
+		{
+			name:         "invalid last event id",
+			stream:       fakeStream{live: live},
+			lastEventID:  "latest",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unavailable",
+			stream:       fakeStream{err: outbox.ErrStreamUnavailable},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, WithEventStream(tt.stream))
+			r := httptest.NewRequest("GET", "/users/events", nil)
+			if tt.lastEventID != "" {
+				r.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("status code = %v, want %v", w.Code, tt.expectedCode)
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != eventStreamType {
+				t.Errorf("Content-Type = %q, want %q", got, eventStreamType)
+			}
+			var ids []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Errorf("event ids = %v, want %v", ids, tt.expectedIDs)
+			}
+		})
+	}
+}
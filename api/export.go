@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+const csvType = "text/csv"
+
+// exportFlushRows is how many users are written between flushes, so the
+// client receives rows while the export runs.
+const exportFlushRows = 1000
+
+var exportExtensions = map[string]string{
+	ndjsonType: ".ndjson",
+	csvType:    ".csv",
+}
+
+var errNotAcceptable = errors.New("not acceptable, use application/x-ndjson or text/csv")
+
+// exportEncoder writes users one by one in the selected columns.
+type exportEncoder interface {
+	header(columns []string) error
+	encode(user *logic.User, columns []string) error
+	flush() error
+}
+
+// negotiateExport picks the media type of the export from the Accept
+// header in the order listed. NDJSON is the default.
+func negotiateExport(r *http.Request) (string, error) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return ndjsonType, nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ndjsonType, "application/*", "*/*":
+			return ndjsonType, nil
+		case csvType, "text/*":
+			return csvType, nil
+		}
+	}
+	return "", errNotAcceptable
+}
+
+func getColumns(r *http.Request) []string {
+	param := r.URL.Query().Get("columns")
+	if param == "" {
+		return logic.ExportColumns
+	}
+	columns := strings.Split(param, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+func newExportEncoder(w io.Writer, mediaType string) exportEncoder {
+	if mediaType == csvType {
+		return &csvEncoder{w: csv.NewWriter(w)}
+	}
+	return &ndjsonEncoder{w: w}
+}
+
+type ndjsonEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (e *ndjsonEncoder) header([]string) error {
+	return nil
+}
+
+// encode writes the columns in the requested order, which a map would
+// not keep.
+func (e *ndjsonEncoder) encode(user *logic.User, columns []string) error {
+	e.buf.Reset()
+	e.buf.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(user.Column(column))
+		if err != nil {
+			return err
+		}
+		e.buf.Write(key)
+		e.buf.WriteByte(':')
+		e.buf.Write(value)
+	}
+	e.buf.WriteString("}\n")
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvEncoder) header(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvEncoder) encode(user *logic.User, columns []string) error {
+	e.record = e.record[:0]
+	for _, column := range columns {
+		e.record = append(e.record, csvValue(user.Column(column)))
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// exportWriter flushes encoded users to the client every exportFlushRows
+// users and tells whether the response was started.
+type exportWriter struct {
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	enc       exportEncoder
+	mediaType string
+	columns   []string
+	rows      int
+	started   bool
+}
+
+func newExportWriter(w http.ResponseWriter, mediaType string, columns []string) *exportWriter {
+	return &exportWriter{
+		w:         w,
+		rc:        http.NewResponseController(w),
+		enc:       newExportEncoder(w, mediaType),
+		mediaType: mediaType,
+		columns:   columns,
+	}
+}
+
+// start sets the headers and writes the header row, deferred to the first
+// user so that errors before it can still be answered with a status.
+func (e *exportWriter) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	e.w.Header().Set("Content-Type", e.mediaType)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "users"+exportExtensions[e.mediaType]))
+	return e.enc.header(e.columns)
+}
+
+func (e *exportWriter) write(user *logic.User) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	if err := e.enc.encode(user, e.columns); err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if err := e.enc.flush(); err != nil {
+		return err
+	}
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
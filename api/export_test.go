@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_negotiateExport(t *testing.T) {
+	tests := []struct {
+		name              string
+		givenAccept       string
+		expectedMediaType string
+		expectedErr       bool
+	}{
+		{
+			name:              "no accept",
+			expectedMediaType: ndjsonType,
+		},
+		{
+			name:              "csv",
+			givenAccept:       "text/csv; charset=utf-8",
+			expectedMediaType: csvType,
+		},
+		{
+			name:              "first acceptable",
+			givenAccept:       "application/xml, text/csv, application/x-ndjson",
+			expectedMediaType: csvType,
+		},
+		{
+			name:              "any",
+			givenAccept:       "*/*",
+			expectedMediaType: ndjsonType,
+		},
+		{
+			name:        "not acceptable",
+			givenAccept: "application/xml",
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/users/export", nil)
+			if tt.givenAccept != "" {
+				r.Header.Set("Accept", tt.givenAccept)
+			}
+			got, err := negotiateExport(r)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("negotiateExport() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if got != tt.expectedMediaType {
+				t.Errorf("negotiateExport() = %v, want %v", got, tt.expectedMediaType)
+			}
+		})
+	}
+}
+
+func Test_exportWriter(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	users := []*logic.User{
+		{ID: 1, Name: "kapitan", Other: "a, b", CreatedAt: createdAt},
+		{ID: 2, Name: "porucznik", CreatedAt: createdAt},
+	}
+	tests := []struct {
+		name            string
+		givenMediaType  string
+		givenColumns    []string
+		givenUsers      []*logic.User
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "ndjson",
+			givenMediaType: ndjsonType,
+			givenColumns:   []string{"name", "id", "updated_at"},
+			givenUsers:     users,
+			expectedBody:   "{\"name\":\"kapitan\",\"id\":1,\"updated_at\":null}\n{\"name\":\"porucznik\",\"id\":2,\"updated_at\":null}\n",
+			expectedHeaders: map[string]string{
+				"Content-Type":        ndjsonType,
+				"Content-Disposition": `attachment; filename="users.ndjson"`,
+			},
+		},
+		{
+			name:           "csv",
+			givenMediaType: csvType,
+			givenColumns:   []string{"id", "other", "created_at"},
+			givenUsers:     users,
+			expectedBody:   "id,other,created_at\n1,\"a, b\",2024-01-02T03:04:05Z\n2,,2024-01-02T03:04:05Z\n",
+			expectedHeaders: map[string]string{
+				"Content-Type":        csvType,
+				"Content-Disposition": `attachment; filename="users.csv"`,
+			},
+		},
+		{
+			name:           "empty csv",
+			givenMediaType: csvType,
+			givenColumns:   []string{"id", "name"},
+			expectedBody:   "id,name\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ew := newExportWriter(w, tt.givenMediaType, tt.givenColumns)
+			for _, user := range tt.givenUsers {
+				if err := ew.write(user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ew.start(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ew.flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Body.String(); got != tt.expectedBody {
+				t.Errorf("body = %q, want %q", got, tt.expectedBody)
+			}
+			for key, value := range tt.expectedHeaders {
+				if got := w.Header().Get(key); got != value {
+					t.Errorf("header %s = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
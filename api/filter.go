@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+// getFilter parses the list filter query params. Times are RFC 3339.
+func getFilter(r *http.Request) (logic.Filter, error) {
+	query := r.URL.Query()
+	filter := logic.Filter{
+		Name:       query.Get("name"),
+		NamePrefix: query.Get("name_prefix"),
+	}
+	times := []struct {
+		key   string
+		value **time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+		{"updated_since", &filter.UpdatedSince},
+	}
+	for _, t := range times {
+		parsed, err := getTimeParam(r, t.key)
+		if err != nil {
+			return filter, err
+		}
+		*t.value = parsed
+	}
+	if param := query.Get("has_other"); param != "" {
+		hasOther, err := strconv.ParseBool(param)
+		if err != nil {
+			return filter, fmt.Errorf("parsing bool has_other: %w", err)
+		}
+		filter.HasOther = &hasOther
+	}
+	includeDeleted, err := getBoolParam(r, "include_deleted")
+	if err != nil {
+		return filter, err
+	}
+	filter.IncludeDeleted = includeDeleted
+	return filter, nil
+}
+
+// getTimeParam parses an RFC 3339 time, nil when absent.
+func getTimeParam(r *http.Request, key string) (*time.Time, error) {
+	param := r.URL.Query().Get(key)
+	if param == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return nil, fmt.Errorf("parsing time %s: %w", key, err)
+	}
+	return &parsed, nil
+}
+
+// getAuditFilter parses the audit filter query params.
+func getAuditFilter(r *http.Request) (logic.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := logic.AuditFilter{
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		RequestID: query.Get("request_id"),
+	}
+	if param := query.Get("user_id"); param != "" {
+		userID, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("parsing int user_id: %w", err)
+		}
+		filter.UserID = userID
+	}
+	var err error
+	if filter.CreatedAfter, err = getTimeParam(r, "created_after"); err != nil {
+		return filter, err
+	}
+	filter.CreatedBefore, err = getTimeParam(r, "created_before")
+	return filter, err
+}
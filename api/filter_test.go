@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_getFilter(t *testing.T) {
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	hasOther := false
+	tests := []struct {
+		name           string
+		givenURL       string
+		expectedFilter logic.Filter
+		expectedErr    bool
+	}{
+		{
+			name:           "no filter",
+			givenURL:       "/users",
+			expectedFilter: logic.Filter{},
+		},
+		{
+			name:     "all kinds of filters",
+			givenURL: "/users?name_prefix=adm&updated_since=2024-01-02T03:04:05Z&has_other=false&include_deleted=true",
+			expectedFilter: logic.Filter{
+				NamePrefix:     "adm",
+				UpdatedSince:   &since,
+				HasOther:       &hasOther,
+				IncludeDeleted: true,
+			},
+		},
+		{
+			name:        "invalid time",
+			givenURL:    "/users?created_after=yesterday",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid bool",
+			givenURL:    "/users?has_other=maybe",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid include deleted",
+			givenURL:    "/users?include_deleted=maybe",
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getFilter(httptest.NewRequest("GET", tt.givenURL, nil))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("getFilter() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if !tt.expectedErr && !reflect.DeepEqual(got, tt.expectedFilter) {
+				t.Errorf("getFilter() = %+v, want %+v", got, tt.expectedFilter)
+			}
+		})
+	}
+}
+
+func Test_getAuditFilter(t *testing.T) {
+	after := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name           string
+		givenURL       string
+		expectedFilter logic.AuditFilter
+		expectedErr    bool
+	}{
+		{
+			name:           "no filter",
+			givenURL:       "/audit",
+			expectedFilter: logic.AuditFilter{},
+		},
+		{
+			name:     "all kinds of filters",
+			givenURL: "/audit?user_id=7&actor=admin&action=update&request_id=r1&created_after=2024-01-02T03:04:05Z",
+			expectedFilter: logic.AuditFilter{
+				UserID:       7,
+				Actor:        "admin",
+				Action:       "update",
+				RequestID:    "r1",
+				CreatedAfter: &after,
+			},
+		},
+		{
+			name:        "invalid user id",
+			givenURL:    "/audit?user_id=me",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid time",
+			givenURL:    "/audit?created_before=tomorrow",
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getAuditFilter(httptest.NewRequest("GET", tt.givenURL, nil))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("getAuditFilter() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if !tt.expectedErr && !reflect.DeepEqual(got, tt.expectedFilter) {
+				t.Errorf("getAuditFilter() = %+v, want %+v", got, tt.expectedFilter)
+			}
+		})
+	}
+}
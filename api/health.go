@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// Check is a named readiness check, e.g. DB ping.
+type Check struct {
+	Name  string
+	Check func(context.Context) error
+}
+
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func (h *Handler) healthz(w http.ResponseWriter, _ *http.Request) {
+	handleResult(w, http.StatusOK, HealthResponse{Status: statusOK})
+}
+
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	res := runChecks(r.Context(), h.checks)
+	code := http.StatusOK
+	if res.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	handleResult(w, code, res)
+}
+
+func (h *Handler) version(w http.ResponseWriter, _ *http.Request) {
+	handleResult(w, http.StatusOK, h.buildInfo)
+}
+
+func runChecks(ctx context.Context, checks []Check) HealthResponse {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	res := HealthResponse{
+		Status: statusOK,
+		Checks: make([]CheckResult, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Check(ctx)
+			result := CheckResult{
+				Name:      check.Name,
+				Status:    statusOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = statusError
+				result.Error = err.Error()
+			}
+			res.Checks[i] = result
+		}()
+	}
+	wg.Wait()
+	for _, result := range res.Checks {
+		if result.Status != statusOK {
+			res.Status = statusError
+		}
+	}
+	return res
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+var errUnsupportedImport = errors.New("unsupported media type, use text/csv or application/x-ndjson")
+
+var importFormats = map[string]string{
+	csvType:    logic.ImportCSV,
+	ndjsonType: logic.ImportNDJSON,
+}
+
+// getImportParams reads the import format from Content-Type and the
+// options from query params.
+func getImportParams(r *http.Request) (logic.ImportParams, error) {
+	var params logic.ImportParams
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	params.Format = importFormats[mediaType]
+	if params.Format == "" {
+		return params, errUnsupportedImport
+	}
+	var err error
+	if params.DryRun, err = getBoolParam(r, "dry_run"); err != nil {
+		return params, err
+	}
+	params.OnConflict = r.URL.Query().Get("on_conflict")
+	params.Mapping, err = logic.ParseImportMapping(r.URL.Query().Get("mapping"))
+	return params, err
+}
+
+// importStatusCode is 422 when rows failed validation and nothing was
+// imported.
+func importStatusCode(report *logic.ImportReport) int {
+	if len(report.Errors) > 0 {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusOK
+}
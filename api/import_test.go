@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_getImportParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		givenURL       string
+		givenType      string
+		expectedParams logic.ImportParams
+		expectedErr    error
+	}{
+		{
+			name:           "csv with mapping",
+			givenURL:       "/users:import?mapping=name:login,other:notes&on_conflict=update&dry_run=true",
+			givenType:      "text/csv; charset=utf-8",
+			expectedParams: logic.ImportParams{Format: logic.ImportCSV, Mapping: map[string]string{"name": "login", "other": "notes"}, OnConflict: logic.OnConflictUpdate, DryRun: true},
+		},
+		{
+			name:           "ndjson",
+			givenURL:       "/users:import",
+			givenType:      ndjsonType,
+			expectedParams: logic.ImportParams{Format: logic.ImportNDJSON},
+		},
+		{
+			name:        "unsupported",
+			givenURL:    "/users:import",
+			givenType:   "application/json",
+			expectedErr: errUnsupportedImport,
+		},
+		{
+			name:        "invalid mapping",
+			givenURL:    "/users:import?mapping=name",
+			givenType:   csvType,
+			expectedErr: logic.ErrInvalidImport,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.givenURL, nil)
+			r.Header.Set("Content-Type", tt.givenType)
+			got, err := getImportParams(r)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("getImportParams() error = %v, want %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getImportParams() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expectedParams) {
+				t.Errorf("getImportParams() = %+v, want %+v", got, tt.expectedParams)
+			}
+		})
+	}
+}
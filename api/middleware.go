@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bmcszk/user-service/logging"
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/bmcszk/user-service/tracing"
+)
+
+const (
+	unmatchedRoute     = "unmatched"
+	requestIDHeader    = "X-Request-ID"
+	actorHeader        = "X-Actor"
+	maxRequestIDLength = 128
+)
+
+// instrument traces, measures and logs every request. It must wrap the
+// ServeMux so the route pattern is known after next returns.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := getRequestID(r)
+		w.Header().Set(requestIDHeader, requestID)
+		ctx, span := tracing.StartServerSpan(r)
+		logger := slog.Default().With("request_id", requestID, "method", r.Method, "path", r.URL.Path)
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			logger = logger.With("trace_id", traceID)
+		}
+		ctx = logging.WithRequestID(ctx, requestID)
+		if actor := getActor(r); actor != "" {
+			ctx = logging.WithActor(ctx, actor)
+			logger = logger.With("actor", actor)
+		}
+		ctx = logging.WithLogger(ctx, logger)
+		r = r.WithContext(ctx)
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		duration := time.Since(start)
+		tracing.EndServerSpan(span, r.Pattern, rw.status)
+		metrics.ObserveRequest(routeOf(r), rw.status, duration)
+		level := slog.LevelInfo
+		if rw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger(r).Log(ctx, level, "request", "status", rw.status, "duration", duration)
+	})
+}
+
+// requestLogger returns the request-scoped logger enriched with the route
+// and the user or webhook id once the request is routed. Handlers get it
+// from the context, stored there by Handler.handle.
+func requestLogger(r *http.Request) *slog.Logger {
+	logger := logging.FromContext(r.Context()).With("route", routeOf(r))
+	if key := idKey(r.Pattern); key != "" {
+		if id := r.PathValue("id"); id != "" {
+			logger = logger.With(key, id)
+		}
+	}
+	return logger
+}
+
+// idKey names the id path value of a route pattern by the resource it
+// identifies, empty for routes without one.
+func idKey(pattern string) string {
+	_, path, _ := strings.Cut(pattern, " ")
+	switch {
+	case strings.HasPrefix(path, "/users/{id}"):
+		return "user_id"
+	case strings.HasPrefix(path, "/webhooks/{id}"):
+		return "webhook_id"
+	}
+	return ""
+}
+
+// getRequestID propagates the client request id or generates a new one.
+func getRequestID(r *http.Request) string {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID != "" && len(requestID) <= maxRequestIDLength && isPrintable(requestID) {
+		return requestID
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// getActor returns who makes the request, recorded in the audit log. The
+// header is trusted, so it must be set by an authenticating proxy.
+func getActor(r *http.Request) string {
+	actor := r.Header.Get(actorHeader)
+	if len(actor) > maxRequestIDLength || !isPrintable(actor) {
+		return ""
+	}
+	return actor
+}
+
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func routeOf(r *http.Request) string {
+	if r.Pattern == "" {
+		return unmatchedRoute
+	}
+	return r.Pattern
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bmcszk/user-service/logging"
+	"github.com/bmcszk/user-service/logic"
+	"github.com/bmcszk/user-service/metrics"
+)
+
+func Test_instrument_RequestID(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleLogicError(w, r, logic.ErrUserNotFound)
+	})
+	handler := instrument(mux)
+	tests := []struct {
+		name              string
+		givenRequestID    string
+		expectedRequestID string
+	}{
+		{
+			name:              "propagated",
+			givenRequestID:    "client-request-1",
+			expectedRequestID: "client-request-1",
+		},
+		{
+			name:           "generated",
+			givenRequestID: "",
+		},
+		{
+			name:           "invalid replaced",
+			givenRequestID: "bad id\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+			if tt.givenRequestID != "" {
+				r.Header.Set(requestIDHeader, tt.givenRequestID)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			requestID := w.Header().Get(requestIDHeader)
+			if requestID == "" || requestID == tt.givenRequestID && tt.expectedRequestID == "" {
+				t.Fatalf("%s header = %q, want generated id", requestIDHeader, requestID)
+			}
+			if tt.expectedRequestID != "" && requestID != tt.expectedRequestID {
+				t.Errorf("%s header = %q, want %q", requestIDHeader, requestID, tt.expectedRequestID)
+			}
+			var apiErr ApiError
+			if err := json.NewDecoder(w.Body).Decode(&apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if apiErr.RequestID != requestID {
+				t.Errorf("ApiError.RequestID = %q, want %q", apiErr.RequestID, requestID)
+			}
+		})
+	}
+}
+
+func Test_instrument_Actor(t *testing.T) {
+	var actor string
+	handler := instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = logging.Actor(r.Context())
+	}))
+	tests := []struct {
+		name          string
+		givenActor    string
+		expectedActor string
+	}{
+		{
+			name:          "propagated",
+			givenActor:    "admin@example.com",
+			expectedActor: "admin@example.com",
+		},
+		{
+			name: "absent",
+		},
+		{
+			name:       "invalid dropped",
+			givenActor: "bad actor\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+			if tt.givenActor != "" {
+				r.Header.Set(actorHeader, tt.givenActor)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if actor != tt.expectedActor {
+				t.Errorf("actor = %q, want %q", actor, tt.expectedActor)
+			}
+		})
+	}
+}
+
+func Test_instrument_Metrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /test/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := instrument(mux)
+	matched := requestsCount(t, "GET /test/{id}", "418")
+	unmatched := requestsCount(t, unmatchedRoute, "404")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/2", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if got := requestsCount(t, "GET /test/{id}", "418") - matched; got != 2 {
+		t.Errorf("requests for route = %v, want %v", got, 2)
+	}
+	if got := requestsCount(t, unmatchedRoute, "404") - unmatched; got != 1 {
+		t.Errorf("requests for unmatched route = %v, want %v", got, 1)
+	}
+}
+
+// requestsCount scrapes the number of requests counted for route and code.
+func requestsCount(t *testing.T, route, code string) float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	series := fmt.Sprintf("user_service_http_requests_total{code=%q,route=%q} ", code, route)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series); ok {
+			count, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return count
+		}
+	}
+	return 0
+}
+
+func TestHandler_handle_Logger(t *testing.T) {
+	tests := []struct {
+		name            string
+		givenPattern    string
+		givenPath       string
+		expectedUserID  string
+		expectedWebhook string
+	}{
+		{"user route", "GET /users/{id}/probe", "/users/7/probe", "7", ""},
+		{"webhook route", "GET /webhooks/{id}/probe", "/webhooks/3/probe", "", "3"},
+		{"webhook delivery route", "POST /webhooks/{id}/deliveries/{delivery_id}/probe", "/webhooks/3/deliveries/9/probe", "", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+			defer slog.SetDefault(defaultLogger)
+			h := NewHandler(nil)
+			h.handle(tt.givenPattern, func(w http.ResponseWriter, r *http.Request) {
+				logging.FromContext(r.Context()).Info("probed")
+			})
+			method, _, _ := strings.Cut(tt.givenPattern, " ")
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, tt.givenPath, nil))
+
+			var entry map[string]any
+			if err := json.NewDecoder(&logs).Decode(&entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["msg"] != "probed" || entry["route"] != tt.givenPattern {
+				t.Fatalf("log entry = %v, want probed on route %q", entry, tt.givenPattern)
+			}
+			if userID, _ := entry["user_id"].(string); userID != tt.expectedUserID {
+				t.Errorf("user_id = %q, want %q", userID, tt.expectedUserID)
+			}
+			if webhookID, _ := entry["webhook_id"].(string); webhookID != tt.expectedWebhook {
+				t.Errorf("webhook_id = %q, want %q", webhookID, tt.expectedWebhook)
+			}
+		})
+	}
+}
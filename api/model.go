@@ -5,6 +5,7 @@ import "fmt"
 type ApiError struct {
 	StatusCode int    `json:"status_code"`
 	Message    string `json:"message"`
+	RequestID  string `json:"request_id,omitempty"`
 }
 
 func (e ApiError) Error() string {
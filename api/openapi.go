@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.json
+var openapiSpec []byte
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// swaggerUI holds the Swagger UI assets of the docs page, vendored from
+// swagger-ui-dist.
+//
+//go:generate sh -c "curl -fsSL -o swagger-ui/swagger-ui.css https://unpkg.com/swagger-ui-dist@5.18.2/swagger-ui.css && curl -fsSL -o swagger-ui/swagger-ui-bundle.js https://unpkg.com/swagger-ui-dist@5.18.2/swagger-ui-bundle.js"
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+const (
+	schemaRefPrefix    = "#/components/schemas/"
+	parameterRefPrefix = "#/components/parameters/"
+)
+
+var httpMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+// openAPI is the subset of OpenAPI 3.1 used to validate requests.
+type openAPI struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*schema    `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 schemaType         `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+// schemaType is either a single type or, in OpenAPI 3.1, a list of types.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// requestValidator validates requests against the operations of the spec,
+// keyed by ServeMux pattern, e.g. "GET /users/{id}".
+type requestValidator struct {
+	spec       *openAPI
+	operations map[string]*operation
+}
+
+func newRequestValidator() (*requestValidator, error) {
+	var spec openAPI
+	if err := json.Unmarshal(openapiSpec, &spec); err != nil {
+		return nil, fmt.Errorf("parsing openapi spec: %w", err)
+	}
+	v := &requestValidator{
+		spec:       &spec,
+		operations: make(map[string]*operation),
+	}
+	for path, item := range spec.Paths {
+		for method, raw := range item {
+			if !slices.Contains(httpMethods, method) {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("parsing openapi operation %s %s: %w", method, path, err)
+			}
+			for i, p := range op.Parameters {
+				resolved, err := v.resolveParameter(p)
+				if err != nil {
+					return nil, err
+				}
+				op.Parameters[i] = resolved
+			}
+			v.operations[strings.ToUpper(method)+" "+path] = &op
+		}
+	}
+	return v, nil
+}
+
+func (v *requestValidator) resolveParameter(p *parameter) (*parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	resolved, ok := v.spec.Components.Parameters[strings.TrimPrefix(p.Ref, parameterRefPrefix)]
+	if !ok {
+		return nil, fmt.Errorf("openapi parameter %s not found", p.Ref)
+	}
+	return resolved, nil
+}
+
+func (v *requestValidator) resolveSchema(s *schema) (*schema, error) {
+	for s.Ref != "" {
+		resolved, ok := v.spec.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRefPrefix)]
+		if !ok {
+			return nil, fmt.Errorf("openapi schema %s not found", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
+
+// validate checks the parameters and JSON body of r routed to pattern.
+// Bodies of other media types are not checked. The body is buffered and
+// restored so handlers can read it again.
+func (v *requestValidator) validate(pattern string, r *http.Request) error {
+	op, ok := v.operations[pattern]
+	if !ok {
+		return nil
+	}
+	for _, p := range op.Parameters {
+		var value string
+		switch p.In {
+		case "path":
+			value = r.PathValue(p.Name)
+		case "query":
+			value = r.URL.Query().Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+		default:
+			continue
+		}
+		if value == "" {
+			if p.Required {
+				return fmt.Errorf("%s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+		if err := v.validateParameter(p, value); err != nil {
+			return fmt.Errorf("%s parameter %s: %w", p.In, p.Name, err)
+		}
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "" && mediaType != "application/json" {
+		return nil
+	}
+	content, ok := op.RequestBody.Content["application/json"]
+	if !ok || content.Schema == nil {
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("reading body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("body is required")
+		}
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return fmt.Errorf("parsing body: %w", err)
+	}
+	return v.validateValue("body", content.Schema, body)
+}
+
+func (v *requestValidator) validateParameter(p *parameter, value string) error {
+	if p.Schema == nil {
+		return nil
+	}
+	s, err := v.resolveSchema(p.Schema)
+	if err != nil {
+		return err
+	}
+	var parsed any = value
+	switch {
+	case slices.Contains(s.Type, "integer"):
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		parsed = float64(i)
+	case slices.Contains(s.Type, "number"):
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		parsed = f
+	case slices.Contains(s.Type, "boolean"):
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		parsed = b
+	}
+	return v.validateValue("value", s, parsed)
+}
+
+func (v *requestValidator) validateValue(path string, s *schema, value any) error {
+	s, err := v.resolveSchema(s)
+	if err != nil {
+		return err
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasType(value, t) }) {
+		return fmt.Errorf("%s must be of type %s", path, strings.Join(s.Type, " or "))
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		return fmt.Errorf("%s must be one of %v", path, s.Enum)
+	}
+	switch value := value.(type) {
+	case string:
+		length := len([]rune(value))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s length must be at least %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s length must be at most %d", path, *s.MaxLength)
+		}
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", path, *s.Maximum)
+		}
+	case []any:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return fmt.Errorf("%s must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				if err := v.validateValue(fmt.Sprintf("%s[%d]", path, i), s.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(value)) {
+			propValue := value[name]
+			propSchema, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s.%s is not allowed", path, name)
+				}
+				continue
+			}
+			if err := v.validateValue(path+"."+name, propSchema, propValue); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+func (h *Handler) openapi(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openapiSpec)
+}
+
+func (h *Handler) docs(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(swaggerPage)
+}
+
+func (h *Handler) docsAsset(w http.ResponseWriter, r *http.Request) {
+	assets, _ := fs.Sub(swaggerUI, "swagger-ui")
+	http.ServeFileFS(w, r, assets, r.PathValue("asset"))
+}
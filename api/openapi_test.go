@@ -0,0 +1,174 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type fakePool struct{}
+
+func (fakePool) Stat() *pgxpool.Stat {
+	return nil
+}
+
+func Test_openapiSpecMatchesRoutes(t *testing.T) {
+	h := NewHandler(nil, WithPoolStats(fakePool{}), WithEventStream(fakeStream{}), WithRequestValidation())
+
+	for _, route := range h.routes {
+		if _, ok := h.validator.operations[route]; !ok {
+			t.Errorf("route %q not documented in openapi.json", route)
+		}
+	}
+	for operation := range h.validator.operations {
+		if !slices.Contains(h.routes, operation) {
+			t.Errorf("operation %q documented in openapi.json but not routed", operation)
+		}
+	}
+}
+
+func Test_requestValidator_validate(t *testing.T) {
+	validator, err := newRequestValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		pattern     string
+		target      string
+		contentType string
+		body        string
+		expectedErr string
+	}{
+		{
+			name:    "valid user",
+			pattern: "POST /users",
+			target:  "/users",
+			body:    `{"name": "name", "other": "other"}`,
+		},
+		{
+			name:        "missing name",
+			pattern:     "POST /users",
+			target:      "/users",
+			body:        `{"other": "other"}`,
+			expectedErr: "body.name is required",
+		},
+		{
+			name:        "empty name",
+			pattern:     "PUT /users/{id}",
+			target:      "/users/1",
+			body:        `{"name": ""}`,
+			expectedErr: "body.name length must be at least 1",
+		},
+		{
+			name:        "wrong type",
+			pattern:     "POST /users",
+			target:      "/users",
+			body:        `{"name": 7}`,
+			expectedErr: "body.name must be of type string",
+		},
+		{
+			name:        "missing body",
+			pattern:     "POST /users",
+			target:      "/users",
+			expectedErr: "body is required",
+		},
+		{
+			name:        "invalid user in batch",
+			pattern:     "POST /users:batch",
+			target:      "/users:batch",
+			body:        `[{"name": "name"}, {"name": ""}]`,
+			expectedErr: "body[1].name length must be at least 1",
+		},
+		{
+			name:        "body of other media type",
+			pattern:     "POST /users:batch",
+			target:      "/users:batch",
+			contentType: "application/x-ndjson",
+			body:        "{\"name\": \"name\"}\n{\"name\": \"other\"}\n",
+		},
+		{
+			name:        "misspelled bulk filter",
+			pattern:     "POST /users:bulkDelete",
+			target:      "/users:bulkDelete",
+			body:        `{"filter": {"name_prefx": "adm"}}`,
+			expectedErr: "body.filter.name_prefx is not allowed",
+		},
+		{
+			name:        "invalid id",
+			pattern:     "GET /users/{id}",
+			target:      "/users/abc",
+			expectedErr: "path parameter id: must be an integer",
+		},
+		{
+			name:        "id below minimum",
+			pattern:     "DELETE /users/{id}",
+			target:      "/users/0",
+			expectedErr: "path parameter id: value must be at least 1",
+		},
+		{
+			name:        "invalid limit",
+			pattern:     "GET /users",
+			target:      "/users?limit=ten",
+			expectedErr: "query parameter limit: must be an integer",
+		},
+		{
+			name:    "undocumented operation",
+			pattern: "GET /unknown",
+			target:  "/unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, _, _ := strings.Cut(tt.pattern, " ")
+			mux := http.NewServeMux()
+			var err error
+			mux.HandleFunc(tt.pattern, func(_ http.ResponseWriter, r *http.Request) {
+				err = validator.validate(tt.pattern, r)
+			})
+			r := httptest.NewRequest(method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("validate() error = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestHandler_docs_ServesAssets(t *testing.T) {
+	h := NewHandler(nil)
+	page := string(swaggerPage)
+	if strings.Contains(page, "https://") {
+		t.Fatal("docs page loads assets from third-party hosts")
+	}
+	for _, asset := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		t.Run(asset, func(t *testing.T) {
+			if !strings.Contains(page, `"/docs/`+asset+`"`) {
+				t.Fatalf("docs page does not load /docs/%s", asset)
+			}
+			if _, err := fs.Stat(swaggerUI, "swagger-ui/"+asset); err != nil {
+				t.Skipf("%s not vendored, run go generate ./api", asset)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/"+asset, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
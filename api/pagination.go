@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+// linkHeader builds an RFC 8288 Link header with first, prev, next and last
+// pages of a list. Offset requests get offset links, cursor requests get
+// cursor links. Other query params, e.g. filters, are preserved.
+func linkHeader(r *http.Request, params logic.ListParams, res *logic.UsersResponse) string {
+	var links []string
+	add := func(rel string, set func(url.Values)) {
+		query := r.URL.Query()
+		query.Del("offset")
+		query.Del("cursor")
+		query.Set("limit", strconv.Itoa(int(params.Limit)))
+		set(query)
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", u.String(), rel))
+	}
+	offset := func(offset int32) func(url.Values) {
+		return func(query url.Values) {
+			if offset > 0 {
+				query.Set("offset", strconv.Itoa(int(offset)))
+			}
+		}
+	}
+	cursor := func(cursor string) func(url.Values) {
+		return func(query url.Values) {
+			query.Set("cursor", cursor)
+		}
+	}
+
+	add("first", offset(0))
+	if params.Cursor == "" {
+		if params.Offset > 0 {
+			add("prev", offset(max(params.Offset-params.Limit, 0)))
+		}
+		if res.HasMore {
+			add("next", offset(params.Offset+params.Limit))
+		}
+		if res.Total != nil {
+			add("last", offset(lastPageOffset(*res.Total, params.Limit)))
+		}
+	} else {
+		if res.PrevCursor != "" {
+			add("prev", cursor(res.PrevCursor))
+		}
+		if res.NextCursor != "" {
+			add("next", cursor(res.NextCursor))
+		}
+		add("last", cursor(logic.LastPageCursor(params.Sort)))
+	}
+	return strings.Join(links, ", ")
+}
+
+func lastPageOffset(total int64, limit int32) int32 {
+	if total <= 0 {
+		return 0
+	}
+	return int32((total - 1) / int64(limit) * int64(limit))
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bmcszk/user-service/logic"
+)
+
+func Test_linkHeader(t *testing.T) {
+	total := int64(25)
+	tests := []struct {
+		name         string
+		givenURL     string
+		givenParams  logic.ListParams
+		givenRes     *logic.UsersResponse
+		expectedLink string
+	}{
+		{
+			name:         "first offset page",
+			givenURL:     "/users?limit=10",
+			givenParams:  logic.ListParams{Limit: 10},
+			givenRes:     &logic.UsersResponse{Total: &total, HasMore: true},
+			expectedLink: `</users?limit=10>; rel="first", </users?limit=10&offset=10>; rel="next", </users?limit=10&offset=20>; rel="last"`,
+		},
+		{
+			name:         "middle offset page keeps other params",
+			givenURL:     "/users?limit=10&offset=15&total=exact",
+			givenParams:  logic.ListParams{Limit: 10, Offset: 15},
+			givenRes:     &logic.UsersResponse{Total: &total},
+			expectedLink: `</users?limit=10&total=exact>; rel="first", </users?limit=10&offset=5&total=exact>; rel="prev", </users?limit=10&offset=20&total=exact>; rel="last"`,
+		},
+		{
+			name:         "offset page without total",
+			givenURL:     "/users?limit=10&offset=5&total=none",
+			givenParams:  logic.ListParams{Limit: 10, Offset: 5},
+			givenRes:     &logic.UsersResponse{},
+			expectedLink: `</users?limit=10&total=none>; rel="first", </users?limit=10&total=none>; rel="prev"`,
+		},
+		{
+			name:        "cursor page",
+			givenURL:    "/users?limit=10&cursor=abc",
+			givenParams: logic.ListParams{Limit: 10, Cursor: "abc"},
+			givenRes:    &logic.UsersResponse{PrevCursor: "prev", NextCursor: "next"},
+			expectedLink: `</users?limit=10>; rel="first", </users?cursor=prev&limit=10>; rel="prev", </users?cursor=next&limit=10>; rel="next", ` +
+				`</users?cursor=` + logic.LastPageCursor("") + `&limit=10>; rel="last"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.givenURL, nil)
+			if got := linkHeader(r, tt.givenParams, tt.givenRes); got != tt.expectedLink {
+				t.Errorf("linkHeader() = %v, want %v", got, tt.expectedLink)
+			}
+		})
+	}
+}
+
+func Test_lastPageOffset(t *testing.T) {
+	tests := []struct {
+		name           string
+		givenTotal     int64
+		givenLimit     int32
+		expectedOffset int32
+	}{
+		{name: "empty", givenTotal: 0, givenLimit: 10, expectedOffset: 0},
+		{name: "partial last page", givenTotal: 25, givenLimit: 10, expectedOffset: 20},
+		{name: "full last page", givenTotal: 30, givenLimit: 10, expectedOffset: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastPageOffset(tt.givenTotal, tt.givenLimit); got != tt.expectedOffset {
+				t.Errorf("lastPageOffset() = %v, want %v", got, tt.expectedOffset)
+			}
+		})
+	}
+}
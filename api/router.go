@@ -4,92 +4,471 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log/slog"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/logging"
 	"github.com/bmcszk/user-service/logic"
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const defaultLimit = 10
 
+type poolStater interface {
+	Stat() *pgxpool.Stat
+}
+
 type Handler struct {
 	http.Handler
-	service *logic.Service
+	router    *http.ServeMux
+	routes    []string
+	validator *requestValidator
+	service   *logic.Service
+	pool      poolStater
+	events    eventStream
+	checks    []Check
+	buildInfo BuildInfo
+	validate  bool
+}
+
+type Option func(*Handler)
+
+func WithPoolStats(pool poolStater) Option {
+	return func(h *Handler) {
+		h.pool = pool
+	}
 }
 
-func NewHandler(service *logic.Service) *Handler {
+// WithEventStream serves user events as server-sent events.
+func WithEventStream(events eventStream) Option {
+	return func(h *Handler) {
+		h.events = events
+	}
+}
+
+func WithReadinessChecks(checks ...Check) Option {
+	return func(h *Handler) {
+		h.checks = append(h.checks, checks...)
+	}
+}
+
+func WithBuildInfo(buildInfo BuildInfo) Option {
+	return func(h *Handler) {
+		h.buildInfo = buildInfo
+	}
+}
+
+// WithRequestValidation validates path, query params and JSON bodies
+// against the OpenAPI spec before the handlers run.
+func WithRequestValidation() Option {
+	return func(h *Handler) {
+		h.validate = true
+	}
+}
+
+func NewHandler(service *logic.Service, opts ...Option) *Handler {
 	router := http.NewServeMux()
 	h := &Handler{
-		Handler: router,
+		Handler: instrument(router),
+		router:  router,
 		service: service,
 	}
-	router.HandleFunc("POST /users", h.createUser)
-	router.HandleFunc("GET /users/{id}", h.getUserByID)
-	router.HandleFunc("PUT /users/{id}", h.updateUserByID)
-	router.HandleFunc("DELETE /users/{id}", h.deleteUserByID)
-	router.HandleFunc("GET /users", h.listUsers)
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.validate {
+		validator, err := newRequestValidator()
+		if err != nil {
+			panic(err)
+		}
+		h.validator = validator
+	}
+	h.handle("POST /users", h.createUser)
+	h.handle("POST /users:batch", h.createUsers)
+	h.handle("POST /users:import", h.importUsers)
+	h.handle("POST /users:bulkUpdate", h.bulkUpdateUsers)
+	h.handle("POST /users:bulkDelete", h.bulkDeleteUsers)
+	h.handle("GET /users/{id}", h.getUserByID)
+	h.handle("PUT /users/{id}", h.updateUserByID)
+	h.handle("PATCH /users/{id}", h.patchUserByID)
+	h.handle("DELETE /users/{id}", h.deleteUserByID)
+	h.handle("POST /users/{id}/restore", h.restoreUserByID)
+	h.handle("POST /users/{id}/purge", h.purgeUserByID)
+	h.handle("GET /users/{id}/history", h.getUserHistory)
+	h.handle("GET /audit", h.listAudit)
+	h.handle("POST /webhooks", h.createWebhook)
+	h.handle("GET /webhooks", h.listWebhooks)
+	h.handle("GET /webhooks/{id}", h.getWebhook)
+	h.handle("DELETE /webhooks/{id}", h.deleteWebhook)
+	h.handle("GET /webhooks/{id}/deliveries", h.listDeliveries)
+	h.handle("POST /webhooks/{id}/deliveries/{delivery_id}/redeliver", h.redeliver)
+	h.handle("GET /users", h.listUsers)
+	h.handle("GET /users/search", h.searchUsers)
+	h.handle("GET /users/export", h.exportUsers)
+	if h.events != nil {
+		h.handle("GET /users/events", h.streamEvents)
+	}
+	h.handle("GET /healthz", h.healthz)
+	h.handle("GET /readyz", h.readyz)
+	h.handle("GET /version", h.version)
+	h.handle("GET /metrics", metrics.Handler().ServeHTTP)
+	h.handle("GET /openapi.json", h.openapi)
+	h.handle("GET /docs", h.docs)
+	h.handle("GET /docs/{asset}", h.docsAsset)
+	if h.pool != nil {
+		h.handle("GET /debug/pool", h.poolStats)
+	}
 	return h
 }
 
+// handle routes pattern to handler, with the route and user id added to the
+// request-scoped logger, so that logs of the service have them too.
+func (h *Handler) handle(pattern string, handler http.HandlerFunc) {
+	h.routes = append(h.routes, pattern)
+	h.router.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(logging.WithLogger(r.Context(), requestLogger(r)))
+		if h.validator != nil {
+			if err := h.validator.validate(pattern, r); err != nil {
+				handleInputError(w, r, fmt.Errorf("request validation: %w", err))
+				return
+			}
+		}
+		handler(w, r)
+	})
+}
+
 func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
 	var user logic.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
 	res, err := h.service.CreateUser(r.Context(), user)
 	if err != nil {
-		handleLogicError(w, err)
+		handleLogicError(w, r, err)
 		return
 	}
-	handleResult(w, http.StatusCreated, res)
+	handleUserResult(w, http.StatusCreated, res)
+}
+
+func (h *Handler) createUsers(w http.ResponseWriter, r *http.Request) {
+	atomic, err := getBoolParam(r, "atomic")
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	users, err := decodeBatch(r)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	results, err := h.service.CreateUsers(r.Context(), users, atomic)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	res := toBatchResponse(results)
+	handleResult(w, batchStatusCode(res), res)
+}
+
+func (h *Handler) importUsers(w http.ResponseWriter, r *http.Request) {
+	params, err := getImportParams(r)
+	if errors.Is(err, errUnsupportedImport) {
+		handleStatusError(w, r, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	report, err := h.service.ImportUsers(r.Context(), r.Body, params)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, importStatusCode(report), report)
+}
+
+func (h *Handler) bulkUpdateUsers(w http.ResponseWriter, r *http.Request) {
+	var update logic.BulkUpdate
+	if err := decodeStrict(r, &update); err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.BulkUpdateUsers(r.Context(), update)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) bulkDeleteUsers(w http.ResponseWriter, r *http.Request) {
+	var sel logic.BulkSelector
+	if err := decodeStrict(r, &sel); err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.BulkDeleteUsers(r.Context(), sel)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
 }
 
 func (h *Handler) getUserByID(w http.ResponseWriter, r *http.Request) {
 	idParam := r.PathValue("id")
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
+		return
+	}
+	includeDeleted, err := getBoolParam(r, "include_deleted")
+	if err != nil {
+		handleInputError(w, r, err)
 		return
 	}
-	user, err := h.service.GetUserByID(r.Context(), id)
+	asOf, err := getTimeParam(r, "as_of")
 	if err != nil {
-		handleLogicError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
-	handleResult(w, http.StatusOK, user)
+	var user *logic.User
+	if asOf != nil {
+		user, err = h.service.GetUserAsOf(r.Context(), id, *asOf, includeDeleted)
+	} else {
+		user, err = h.service.GetUserByID(r.Context(), id, includeDeleted)
+	}
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleUserResult(w, http.StatusOK, user)
 }
 
 func (h *Handler) updateUserByID(w http.ResponseWriter, r *http.Request) {
 	idParam := r.PathValue("id")
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
 	var user logic.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
-	res, err := h.service.UpdateUserByID(r.Context(), id, user)
+	res, err := h.service.UpdateUserByID(r.Context(), id, user, getPrecondition(r))
 	if err != nil {
-		handleLogicError(w, err)
+		handleLogicError(w, r, err)
 		return
 	}
-	handleResult(w, http.StatusOK, res)
+	handleUserResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) patchUserByID(w http.ResponseWriter, r *http.Request) {
+	idParam := r.PathValue("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	patchType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.PatchUserByID(r.Context(), id, patchType, patch, getPrecondition(r))
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleUserResult(w, http.StatusOK, res)
 }
 
 func (h *Handler) deleteUserByID(w http.ResponseWriter, r *http.Request) {
 	idParam := r.PathValue("id")
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
-	if err := h.service.DeleteUserByID(r.Context(), id); err != nil {
-		handleLogicError(w, err)
+	if err := h.service.DeleteUserByID(r.Context(), id, getPrecondition(r)); err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) restoreUserByID(w http.ResponseWriter, r *http.Request) {
+	idParam := r.PathValue("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.RestoreUserByID(r.Context(), id)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleUserResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) getUserHistory(w http.ResponseWriter, r *http.Request) {
+	idParam := r.PathValue("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	limit, err := getParam(r, "limit", defaultLimit)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.GetUserHistory(r.Context(), id, logic.AuditParams{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) listAudit(w http.ResponseWriter, r *http.Request) {
+	limit, err := getParam(r, "limit", defaultLimit)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	filter, err := getAuditFilter(r)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.ListAudit(r.Context(), logic.AuditParams{
+		Filter: filter,
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook logic.Webhook
+	if err := decodeStrict(r, &webhook); err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusCreated, res)
+}
+
+func (h *Handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	res, err := h.service.ListWebhooks(r.Context())
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.GetWebhook(r.Context(), id)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	if err := h.service.DeleteWebhook(r.Context(), id); err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	limit, err := getParam(r, "limit", defaultLimit)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.ListDeliveries(r.Context(), id, logic.DeliveryParams{
+		Status: r.URL.Query().Get("status"),
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusOK, res)
+}
+
+func (h *Handler) redeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(r.PathValue("delivery_id"), 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	res, err := h.service.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	handleResult(w, http.StatusAccepted, res)
+}
+
+func (h *Handler) purgeUserByID(w http.ResponseWriter, r *http.Request) {
+	idParam := r.PathValue("id")
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	if err := h.service.PurgeUserByID(r.Context(), id); err != nil {
+		handleLogicError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -98,22 +477,98 @@ func (h *Handler) deleteUserByID(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) {
 	limit, err := getParam(r, "limit", defaultLimit)
 	if err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
 		return
 	}
 	offset, err := getParam(r, "offset", 0)
 	if err != nil {
-		handleInputError(w, err)
+		handleInputError(w, r, err)
+		return
+	}
+	filter, err := getFilter(r)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	if filter.AsOf, err = getTimeParam(r, "as_of"); err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	params := logic.ListParams{
+		Limit:  limit,
+		Offset: offset,
+		Cursor: r.URL.Query().Get("cursor"),
+		Total:  r.URL.Query().Get("total"),
+		Filter: filter,
+		Sort:   r.URL.Query().Get("sort"),
+	}
+	users, err := h.service.ListUsers(r.Context(), params)
+	if err != nil {
+		handleLogicError(w, r, err)
+		return
+	}
+	w.Header().Set("Link", linkHeader(r, params, users))
+	handleResult(w, http.StatusOK, users)
+}
+
+func (h *Handler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := getParam(r, "limit", defaultLimit)
+	if err != nil {
+		handleInputError(w, r, err)
 		return
 	}
-	users, err := h.service.ListUsers(r.Context(), limit, offset)
+	users, err := h.service.SearchUsers(r.Context(), logic.SearchParams{
+		Query: r.URL.Query().Get("q"),
+		Limit: limit,
+	})
 	if err != nil {
-		handleLogicError(w, err)
+		handleLogicError(w, r, err)
 		return
 	}
 	handleResult(w, http.StatusOK, users)
 }
 
+// exportUsers streams users as NDJSON or CSV. The write timeout is lifted
+// as exports of large tables outlast it. An error after the response has
+// started aborts it, so clients do not take a truncated export as complete.
+func (h *Handler) exportUsers(w http.ResponseWriter, r *http.Request) {
+	mediaType, err := negotiateExport(r)
+	if err != nil {
+		handleStatusError(w, r, http.StatusNotAcceptable, err)
+		return
+	}
+	filter, err := getFilter(r)
+	if err != nil {
+		handleInputError(w, r, err)
+		return
+	}
+	params := logic.ExportParams{
+		Filter:  filter,
+		Columns: getColumns(r),
+	}
+	ew := newExportWriter(w, mediaType, params.Columns)
+	_ = ew.rc.SetWriteDeadline(time.Time{})
+	err = h.service.ExportUsers(r.Context(), params, ew.write)
+	if err == nil {
+		if err = ew.start(); err == nil {
+			err = ew.flush()
+		}
+	}
+	if err == nil {
+		return
+	}
+	if !ew.started {
+		handleLogicError(w, r, err)
+		return
+	}
+	logging.FromContext(r.Context()).With("error", err, "rows", ew.rows).Error("export aborted")
+	panic(http.ErrAbortHandler)
+}
+
+func (h *Handler) poolStats(w http.ResponseWriter, _ *http.Request) {
+	handleResult(w, http.StatusOK, db.FromPoolStat(h.pool.Stat()))
+}
+
 func getParam(r *http.Request, key string, defaultValue int32) (int32, error) {
 	param := r.URL.Query().Get(key)
 	if param == "" {
@@ -126,6 +581,26 @@ func getParam(r *http.Request, key string, defaultValue int32) (int32, error) {
 	return int32(i), nil
 }
 
+func getBoolParam(r *http.Request, key string) (bool, error) {
+	param := r.URL.Query().Get(key)
+	if param == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, fmt.Errorf("parsing bool %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// decodeStrict decodes a JSON body rejecting unknown fields, so that a
+// misspelled filter does not select every user.
+func decodeStrict(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
 func handleResult(w http.ResponseWriter, code int, v any) {
 	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
@@ -134,21 +609,27 @@ func handleResult(w http.ResponseWriter, code int, v any) {
 	}
 }
 
-func handleInputError(w http.ResponseWriter, err error) {
-	code := http.StatusBadRequest
-	slog.With("error", err, "code", code).Error("invalid input")
+func handleInputError(w http.ResponseWriter, r *http.Request, err error) {
+	handleStatusError(w, r, http.StatusBadRequest, err)
+}
+
+func handleStatusError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	logging.FromContext(r.Context()).With("error", err, "code", code).Error("invalid input")
 	handleResult(w, code, ApiError{
 		StatusCode: code,
 		Message:    err.Error(),
+		RequestID:  logging.RequestID(r.Context()),
 	})
 }
 
-func handleLogicError(w http.ResponseWriter, err error) {
+func handleLogicError(w http.ResponseWriter, r *http.Request, err error) {
 	code := getStatusCode(err)
-	slog.With("error", err, "code", code).Error("logic error")
+	metrics.LogicError(getErrorName(err))
+	logging.FromContext(r.Context()).With("error", err, "code", code).Error("logic error")
 	handleResult(w, code, ApiError{
 		StatusCode: code,
 		Message:    err.Error(),
+		RequestID:  logging.RequestID(r.Context()),
 	})
 }
 
@@ -162,5 +643,126 @@ func getStatusCode(err error) int {
 	if errors.Is(err, logic.ErrUserNameEmpty) {
 		return http.StatusBadRequest
 	}
+	if errors.Is(err, logic.ErrUserNotDeleted) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, logic.ErrWebhookNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, logic.ErrDeliveryNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, logic.ErrInvalidWebhook) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidPagination) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidFilter) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidSort) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidSearch) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidPatch) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidBatch) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrBatchAborted) {
+		return http.StatusFailedDependency
+	}
+	if errors.Is(err, logic.ErrInvalidBulk) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidExport) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrInvalidImport) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, logic.ErrTooManyUsers) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, logic.ErrUnsupportedPatch) {
+		return http.StatusUnsupportedMediaType
+	}
+	if errors.Is(err, logic.ErrVersionMismatch) {
+		return http.StatusPreconditionFailed
+	}
+	if errors.Is(err, logic.ErrPreconditionRequired) {
+		return http.StatusPreconditionRequired
+	}
 	return http.StatusInternalServerError
 }
+
+func getErrorName(err error) string {
+	if errors.Is(err, logic.ErrUserNotFound) {
+		return "user_not_found"
+	}
+	if errors.Is(err, logic.ErrUserAlreadyExists) {
+		return "user_already_exists"
+	}
+	if errors.Is(err, logic.ErrUserNameEmpty) {
+		return "user_name_empty"
+	}
+	if errors.Is(err, logic.ErrUserNotDeleted) {
+		return "user_not_deleted"
+	}
+	if errors.Is(err, logic.ErrWebhookNotFound) {
+		return "webhook_not_found"
+	}
+	if errors.Is(err, logic.ErrDeliveryNotFound) {
+		return "delivery_not_found"
+	}
+	if errors.Is(err, logic.ErrInvalidWebhook) {
+		return "invalid_webhook"
+	}
+	if errors.Is(err, logic.ErrInvalidPagination) {
+		return "invalid_pagination"
+	}
+	if errors.Is(err, logic.ErrInvalidFilter) {
+		return "invalid_filter"
+	}
+	if errors.Is(err, logic.ErrInvalidSort) {
+		return "invalid_sort"
+	}
+	if errors.Is(err, logic.ErrInvalidSearch) {
+		return "invalid_search"
+	}
+	if errors.Is(err, logic.ErrInvalidPatch) {
+		return "invalid_patch"
+	}
+	if errors.Is(err, logic.ErrInvalidBatch) {
+		return "invalid_batch"
+	}
+	if errors.Is(err, logic.ErrBatchAborted) {
+		return "batch_aborted"
+	}
+	if errors.Is(err, logic.ErrInvalidBulk) {
+		return "invalid_bulk"
+	}
+	if errors.Is(err, logic.ErrInvalidExport) {
+		return "invalid_export"
+	}
+	if errors.Is(err, logic.ErrInvalidImport) {
+		return "invalid_import"
+	}
+	if errors.Is(err, logic.ErrTooManyUsers) {
+		return "too_many_users"
+	}
+	if errors.Is(err, logic.ErrUnsupportedPatch) {
+		return "unsupported_patch"
+	}
+	if errors.Is(err, logic.ErrVersionMismatch) {
+		return "version_mismatch"
+	}
+	if errors.Is(err, logic.ErrPreconditionRequired) {
+		return "precondition_required"
+	}
+	return "internal"
+}
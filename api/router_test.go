@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -29,6 +31,51 @@ func Test_getStatusCode(t *testing.T) {
 			givenErr:     logic.ErrUserNameEmpty,
 			expectedCode: http.StatusBadRequest,
 		},
+		{
+			name:         "user not deleted",
+			givenErr:     logic.ErrUserNotDeleted,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "webhook not found",
+			givenErr:     logic.ErrWebhookNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "invalid webhook",
+			givenErr:     fmt.Errorf("%w: secret must have at least 16 characters", logic.ErrInvalidWebhook),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid filter",
+			givenErr:     fmt.Errorf("%w: name and name_prefix cannot be combined", logic.ErrInvalidFilter),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "batch aborted",
+			givenErr:     logic.ErrBatchAborted,
+			expectedCode: http.StatusFailedDependency,
+		},
+		{
+			name:         "too many users",
+			givenErr:     fmt.Errorf("%w: more than 1000 users selected", logic.ErrTooManyUsers),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unsupported patch",
+			givenErr:     logic.ErrUnsupportedPatch,
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "version mismatch",
+			givenErr:     logic.ErrVersionMismatch,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:         "precondition required",
+			givenErr:     logic.ErrPreconditionRequired,
+			expectedCode: http.StatusPreconditionRequired,
+		},
 		{
 			name:         "any error",
 			givenErr:     errors.New("icecream on sidewalk"),
@@ -43,3 +90,75 @@ func Test_getStatusCode(t *testing.T) {
 		})
 	}
 }
+
+func Test_getErrorName(t *testing.T) {
+	tests := []struct {
+		name         string
+		givenErr     error
+		expectedName string
+	}{
+		{
+			name:         "user not found",
+			givenErr:     fmt.Errorf("getting user: %w", logic.ErrUserNotFound),
+			expectedName: "user_not_found",
+		},
+		{
+			name:         "invalid sort",
+			givenErr:     fmt.Errorf("%w: column \"other\" repeated", logic.ErrInvalidSort),
+			expectedName: "invalid_sort",
+		},
+		{
+			name:         "any error",
+			givenErr:     errors.New("icecream on sidewalk"),
+			expectedName: "internal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getErrorName(tt.givenErr); got != tt.expectedName {
+				t.Errorf("getErrorName() = %v, want %v", got, tt.expectedName)
+			}
+		})
+	}
+}
+
+func Test_runChecks(t *testing.T) {
+	ok := Check{Name: "ok", Check: func(context.Context) error { return nil }}
+	failing := Check{Name: "failing", Check: func(context.Context) error { return errors.New("db down") }}
+	tests := []struct {
+		name           string
+		givenChecks    []Check
+		expectedStatus string
+	}{
+		{
+			name:           "no checks",
+			expectedStatus: statusOK,
+		},
+		{
+			name:           "all checks pass",
+			givenChecks:    []Check{ok, ok},
+			expectedStatus: statusOK,
+		},
+		{
+			name:           "one check fails",
+			givenChecks:    []Check{ok, failing},
+			expectedStatus: statusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runChecks(context.Background(), tt.givenChecks)
+			if got.Status != tt.expectedStatus {
+				t.Errorf("runChecks().Status = %v, want %v", got.Status, tt.expectedStatus)
+			}
+			if len(got.Checks) != len(tt.givenChecks) {
+				t.Fatalf("runChecks() returned %d results, want %d", len(got.Checks), len(tt.givenChecks))
+			}
+			for i, check := range tt.givenChecks {
+				if got.Checks[i].Name != check.Name {
+					t.Errorf("runChecks().Checks[%d].Name = %v, want %v", i, got.Checks[i].Name, check.Name)
+				}
+			}
+		})
+	}
+}
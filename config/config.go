@@ -0,0 +1,427 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is loaded in order of precedence: defaults, YAML file, env vars
+// (KEY or KEY_FILE with the value stored in a file) and command-line flags.
+type Config struct {
+	ListenAddr string   `yaml:"listen_addr"`
+	DB         DB       `yaml:"db"`
+	Log        Log      `yaml:"log"`
+	Server     Server   `yaml:"server"`
+	Tracing    Tracing  `yaml:"tracing"`
+	Outbox     Outbox   `yaml:"outbox"`
+	Webhooks   Webhooks `yaml:"webhooks"`
+}
+
+type DB struct {
+	URL               string        `yaml:"url"`
+	Password          string        `yaml:"password"`
+	MaxConns          int32         `yaml:"max_conns"`
+	MinConns          int32         `yaml:"min_conns"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type Server struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	ValidateRequests  bool          `yaml:"validate_requests"`
+	RequireIfMatch    bool          `yaml:"require_if_match"`
+	BulkMaxRows       int32         `yaml:"bulk_max_rows"`
+	DebugPool         bool          `yaml:"debug_pool"`
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Outbox configures the relay publishing user events. Publisher "none"
+// leaves events in the outbox.
+type Outbox struct {
+	Publisher    string        `yaml:"publisher"`
+	URL          string        `yaml:"url"`
+	Timeout      time.Duration `yaml:"timeout"`
+	BatchSize    int32         `yaml:"batch_size"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+}
+
+// Webhooks configures the dispatcher delivering events to webhooks. A
+// delivery is dead after MaxAttempts failures. Webhooks reach only public
+// addresses and those in AllowedNetworks, CIDRs like 10.1.0.0/16.
+type Webhooks struct {
+	MaxAttempts     int32         `yaml:"max_attempts"`
+	Timeout         time.Duration `yaml:"timeout"`
+	BatchSize       int32         `yaml:"batch_size"`
+	PollInterval    time.Duration `yaml:"poll_interval"`
+	MaxBackoff      time.Duration `yaml:"max_backoff"`
+	AllowedNetworks []string      `yaml:"allowed_networks"`
+}
+
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"LISTEN_ADDR", "listen-addr", "http listen address", stringSetter(func(c *Config) *string { return &c.ListenAddr })},
+	{"POSTGRES_URL", "postgres-url", "postgres connection url", stringSetter(func(c *Config) *string { return &c.DB.URL })},
+	{"POSTGRES_PASSWORD", "postgres-password", "postgres password, overrides the one in url", stringSetter(func(c *Config) *string { return &c.DB.Password })},
+	{"DB_MAX_CONNS", "db-max-conns", "maximum number of connections in the pool", int32Setter(func(c *Config) *int32 { return &c.DB.MaxConns })},
+	{"DB_MIN_CONNS", "db-min-conns", "minimum number of connections in the pool", int32Setter(func(c *Config) *int32 { return &c.DB.MinConns })},
+	{"DB_MAX_CONN_IDLE_TIME", "db-max-conn-idle-time", "duration after which an idle connection is closed", durationSetter(func(c *Config) *time.Duration { return &c.DB.MaxConnIdleTime })},
+	{"DB_MAX_CONN_LIFETIME", "db-max-conn-lifetime", "duration after which a connection is closed", durationSetter(func(c *Config) *time.Duration { return &c.DB.MaxConnLifetime })},
+	{"DB_HEALTH_CHECK_PERIOD", "db-health-check-period", "how often idle connections are checked", durationSetter(func(c *Config) *time.Duration { return &c.DB.HealthCheckPeriod })},
+	{"LOG_LEVEL", "log-level", "log level: debug, info, warn, error", stringSetter(func(c *Config) *string { return &c.Log.Level })},
+	{"LOG_FORMAT", "log-format", "log format: text, json", stringSetter(func(c *Config) *string { return &c.Log.Format })},
+	{"HTTP_READ_TIMEOUT", "http-read-timeout", "maximum duration for reading the entire request", durationSetter(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{"HTTP_READ_HEADER_TIMEOUT", "http-read-header-timeout", "maximum duration for reading request headers", durationSetter(func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{"HTTP_WRITE_TIMEOUT", "http-write-timeout", "maximum duration before timing out writes of the response", durationSetter(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{"HTTP_IDLE_TIMEOUT", "http-idle-timeout", "maximum duration to wait for the next request on keep-alive connections", durationSetter(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "grace period for in-flight requests on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"VALIDATE_REQUESTS", "validate-requests", "validate requests against the OpenAPI spec", boolSetter(func(c *Config) *bool { return &c.Server.ValidateRequests })},
+	{"REQUIRE_IF_MATCH", "require-if-match", "reject updates and deletes without If-Match with 428", boolSetter(func(c *Config) *bool { return &c.Server.RequireIfMatch })},
+	{"BULK_MAX_ROWS", "bulk-max-rows", "maximum users a bulk update or delete may affect", int32Setter(func(c *Config) *int32 { return &c.Server.BulkMaxRows })},
+	{"DEBUG_POOL", "debug-pool", "serve DB connection pool statistics at /debug/pool", boolSetter(func(c *Config) *bool { return &c.Server.DebugPool })},
+	{"TRACING_EXPORTER", "tracing-exporter", "tracing exporter: none, stdout, otlp", stringSetter(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", "otlp-endpoint", "OTLP/HTTP collector url", stringSetter(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"TRACING_SAMPLE_RATIO", "tracing-sample-ratio", "ratio of traces sampled, from 0 to 1", float64Setter(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"OUTBOX_PUBLISHER", "outbox-publisher", "user events publisher: none, log, http", stringSetter(func(c *Config) *string { return &c.Outbox.Publisher })},
+	{"OUTBOX_URL", "outbox-url", "url user events are posted to by the http publisher", stringSetter(func(c *Config) *string { return &c.Outbox.URL })},
+	{"OUTBOX_TIMEOUT", "outbox-timeout", "maximum duration of publishing an event", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.Timeout })},
+	{"OUTBOX_BATCH_SIZE", "outbox-batch-size", "maximum events claimed and published at once", int32Setter(func(c *Config) *int32 { return &c.Outbox.BatchSize })},
+	{"OUTBOX_POLL_INTERVAL", "outbox-poll-interval", "how often the outbox is polled when idle", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.PollInterval })},
+	{"OUTBOX_MAX_BACKOFF", "outbox-max-backoff", "maximum delay before retrying a failed event", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.MaxBackoff })},
+	{"WEBHOOK_MAX_ATTEMPTS", "webhook-max-attempts", "failed attempts after which a webhook delivery is dead", int32Setter(func(c *Config) *int32 { return &c.Webhooks.MaxAttempts })},
+	{"WEBHOOK_TIMEOUT", "webhook-timeout", "maximum duration of a webhook delivery attempt", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.Timeout })},
+	{"WEBHOOK_BATCH_SIZE", "webhook-batch-size", "maximum webhook deliveries claimed and attempted at once", int32Setter(func(c *Config) *int32 { return &c.Webhooks.BatchSize })},
+	{"WEBHOOK_POLL_INTERVAL", "webhook-poll-interval", "how often due webhook deliveries are polled when idle", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.PollInterval })},
+	{"WEBHOOK_MAX_BACKOFF", "webhook-max-backoff", "maximum delay before retrying a failed webhook delivery", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.MaxBackoff })},
+	{"WEBHOOK_ALLOWED_NETWORKS", "webhook-allowed-networks", "comma-separated CIDRs webhooks may reach besides public addresses", stringsSetter(func(c *Config) *[]string { return &c.Webhooks.AllowedNetworks })},
+}
+
+func Default() *Config {
+	return &Config{
+		ListenAddr: ":8080",
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Server: Server{
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			BulkMaxRows:       1000,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		Outbox: Outbox{
+			Publisher:    "log",
+			Timeout:      10 * time.Second,
+			BatchSize:    100,
+			PollInterval: time.Second,
+			MaxBackoff:   5 * time.Minute,
+		},
+		Webhooks: Webhooks{
+			MaxAttempts:  10,
+			Timeout:      10 * time.Second,
+			BatchSize:    50,
+			PollInterval: time.Second,
+			MaxBackoff:   time.Hour,
+		},
+	}
+}
+
+// Load builds the config from command-line args and env vars. The YAML file
+// is read from the -config flag or CONFIG_FILE env var when set.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	fs := flag.NewFlagSet("user-service", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "path to YAML config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		v, ok, err := lookupEnv(getenv, s.env)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.set(c, v); err != nil {
+			return nil, fmt.Errorf("env %s: %w", s.env, err)
+		}
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag != f.Name {
+				continue
+			}
+			if err := s.set(c, *flagValues[s.flag]); err != nil {
+				flagErr = errors.Join(flagErr, fmt.Errorf("flag -%s: %w", s.flag, err))
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// lookupEnv returns the value of key, or the trimmed content of the file
+// pointed by key_FILE.
+func lookupEnv(getenv func(string) string, key string) (string, bool, error) {
+	if v := getenv(key); v != "" {
+		return v, true, nil
+	}
+	path := getenv(key + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("env %s_FILE: %w", key, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("listen address is required"))
+	}
+	if c.DB.URL == "" {
+		errs = append(errs, errors.New("postgres url is required"))
+	} else if _, err := url.Parse(c.DB.URL); err != nil {
+		errs = append(errs, fmt.Errorf("postgres url is invalid: %w", err))
+	}
+	if c.DB.MaxConns < 0 || c.DB.MinConns < 0 {
+		errs = append(errs, errors.New("db connection limits must not be negative"))
+	}
+	if c.DB.MaxConns > 0 && c.DB.MinConns > c.DB.MaxConns {
+		errs = append(errs, fmt.Errorf("db min conns %d greater than max conns %d", c.DB.MinConns, c.DB.MaxConns))
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log format %q not supported, use text or json", c.Log.Format))
+	}
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read timeout", c.Server.ReadTimeout},
+		{"read header timeout", c.Server.ReadHeaderTimeout},
+		{"write timeout", c.Server.WriteTimeout},
+		{"idle timeout", c.Server.IdleTimeout},
+		{"shutdown timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", t.name))
+		}
+	}
+	if c.Server.BulkMaxRows < 1 {
+		errs = append(errs, errors.New("bulk max rows must be positive"))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing exporter %q not supported, use none, stdout or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing sample ratio %v must be between 0 and 1", c.Tracing.SampleRatio))
+	}
+	switch c.Outbox.Publisher {
+	case "none", "log":
+	case "http":
+		if c.Outbox.URL == "" {
+			errs = append(errs, errors.New("outbox url is required for http publisher"))
+		} else if _, err := url.ParseRequestURI(c.Outbox.URL); err != nil {
+			errs = append(errs, fmt.Errorf("outbox url is invalid: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("outbox publisher %q not supported, use none, log or http", c.Outbox.Publisher))
+	}
+	if c.Outbox.BatchSize < 1 {
+		errs = append(errs, errors.New("outbox batch size must be positive"))
+	}
+	if c.Outbox.Timeout <= 0 || c.Outbox.PollInterval <= 0 || c.Outbox.MaxBackoff <= 0 {
+		errs = append(errs, errors.New("outbox timeout, poll interval and max backoff must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 || c.Webhooks.BatchSize < 1 {
+		errs = append(errs, errors.New("webhook max attempts and batch size must be positive"))
+	}
+	if c.Webhooks.Timeout <= 0 || c.Webhooks.PollInterval <= 0 || c.Webhooks.MaxBackoff <= 0 {
+		errs = append(errs, errors.New("webhook timeout, poll interval and max backoff must be positive"))
+	}
+	if _, err := c.Webhooks.AllowedPrefixes(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// ConnString returns the postgres url with the password replaced
+// when it is configured separately.
+func (d DB) ConnString() (string, error) {
+	if d.Password == "" {
+		return d.URL, nil
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return "", fmt.Errorf("parsing postgres url: %w", err)
+	}
+	username := ""
+	if u.User != nil {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, d.Password)
+	return u.String(), nil
+}
+
+func (l Log) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return level, fmt.Errorf("log level %q not supported", l.Level)
+	}
+	return level, nil
+}
+
+// AllowedPrefixes parses AllowedNetworks.
+func (w Webhooks) AllowedPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(w.AllowedNetworks))
+	for i, network := range w.AllowedNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("webhook allowed network %q is invalid: %w", network, err)
+		}
+		prefixes[i] = prefix.Masked()
+	}
+	return prefixes, nil
+}
+
+func stringSetter(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+// stringsSetter splits a comma-separated list, an empty value clears it.
+func stringsSetter(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func int32Setter(field func(*Config) *int32) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("parsing int: %w", err)
+		}
+		*field(c) = int32(i)
+		return nil
+	}
+}
+
+func boolSetter(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("parsing bool: %w", err)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func float64Setter(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("parsing float: %w", err)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("parsing duration: %w", err)
+		}
+		*field(c) = d
+		return nil
+	}
+}
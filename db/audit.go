@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+const listAudit = "-- name: ListAudit :many\nSELECT id, user_id, action, actor, request_id, before, after, created_at FROM audit_log"
+
+// Audit tells who makes a change. It is recorded with the change in the
+// same transaction, with the user rows before and after it, and the change
+// is written to the outbox as an event.
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+// changes are the users changed by a write with their rows before it, nil
+// for created users.
+type changes struct {
+	ids     []int64
+	befores [][]byte
+}
+
+func (c *changes) add(id int64, before []byte) {
+	c.ids = append(c.ids, id)
+	c.befores = append(c.befores, before)
+}
+
+func changed(id int64, before []byte) changes {
+	return changes{ids: []int64{id}, befores: [][]byte{before}}
+}
+
+func created(users []User) changes {
+	var c changes
+	for _, user := range users {
+		c.add(user.ID, nil)
+	}
+	return c
+}
+
+func (q *Queries) CreateUserAudited(ctx context.Context, arg CreateUserParams, audit Audit) (User, error) {
+	var user User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		var err error
+		if user, err = qtx.CreateUser(ctx, arg); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditCreate, changed(user.ID, nil))
+	})
+	return user, err
+}
+
+// UpdateUserAudited locks the user to take its row before the update, and
+// fails like UpdateUser.
+func (q *Queries) UpdateUserAudited(ctx context.Context, arg UpdateUserParams, audit Audit) (User, error) {
+	var user User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		before, err := qtx.snapshot(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+		if user, err = qtx.UpdateUser(ctx, arg); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditUpdate, changed(user.ID, before))
+	})
+	return user, err
+}
+
+// DeleteUserAudited records only a delete that matched a user and returns
+// the rows affected like DeleteUser.
+func (q *Queries) DeleteUserAudited(ctx context.Context, arg DeleteUserParams, audit Audit) (int64, error) {
+	var deleted int64
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		before, err := qtx.snapshot(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+		if deleted, err = qtx.DeleteUser(ctx, arg); err != nil || deleted == 0 {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditDelete, changed(arg.ID, before))
+	})
+	return deleted, err
+}
+
+// RestoreUserAudited records only a restore that matched a deleted user
+// and fails like RestoreUser.
+func (q *Queries) RestoreUserAudited(ctx context.Context, id int64, audit Audit) (User, error) {
+	var user User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		before, err := qtx.snapshot(ctx, id)
+		if err != nil {
+			return err
+		}
+		if user, err = qtx.RestoreUser(ctx, id); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditRestore, changed(id, before))
+	})
+	return user, err
+}
+
+// PurgeUserAudited records only a purge that matched a deleted user, with
+// the user row before it, and returns the rows affected like PurgeUser.
+func (q *Queries) PurgeUserAudited(ctx context.Context, id int64, audit Audit) (int64, error) {
+	var purged int64
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		before, err := qtx.snapshot(ctx, id)
+		if err != nil {
+			return err
+		}
+		if purged, err = qtx.PurgeUser(ctx, id); err != nil || purged == 0 {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditPurge, changed(id, before))
+	})
+	return purged, err
+}
+
+// record writes an audit entry and an outbox event for each of the changed
+// users, with a delivery of each event to every webhook subscribed to it.
+func (q *Queries) record(ctx context.Context, audit Audit, action string, c changes) error {
+	if len(c.ids) == 0 {
+		return nil
+	}
+	requestID := pgtype.Text{String: audit.RequestID, Valid: audit.RequestID != ""}
+	if err := q.CreateAudits(ctx, CreateAuditsParams{
+		Action:    action,
+		Actor:     audit.Actor,
+		RequestID: requestID,
+		Befores:   c.befores,
+		UserIds:   c.ids,
+	}); err != nil {
+		return err
+	}
+	eventType := auditEvents[action]
+	eventIDs, err := q.CreateOutboxEvents(ctx, CreateOutboxEventsParams{
+		EventType: eventType,
+		Befores:   c.befores,
+		RequestID: requestID,
+		UserIds:   c.ids,
+	})
+	if err != nil {
+		return err
+	}
+	return q.CreateWebhookDeliveries(ctx, CreateWebhookDeliveriesParams{
+		EventIds:  eventIDs,
+		EventType: eventType,
+	})
+}
+
+// snapshot returns the user row as JSON, or nil when there is no user, in
+// which case the write that follows matches nothing.
+func (q *Queries) snapshot(ctx context.Context, id int64) ([]byte, error) {
+	before, err := q.GetUserSnapshot(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return before, err
+}
+
+// AuditFilter narrows listed audit entries. Zero fields do not filter.
+// The time range is half-open like in UserFilter.
+type AuditFilter struct {
+	UserID        int64
+	Actor         string
+	Action        string
+	RequestID     string
+	CreatedAfter  pgtype.Timestamp
+	CreatedBefore pgtype.Timestamp
+}
+
+// ListAuditParams selects entries newest first, before BeforeID when set.
+type ListAuditParams struct {
+	Filter   AuditFilter
+	BeforeID int64
+	Limit    int32
+}
+
+func (f AuditFilter) apply(w *where) {
+	if f.UserID != 0 {
+		w.add("user_id = %s", f.UserID)
+	}
+	if f.Actor != "" {
+		w.add("actor = %s", f.Actor)
+	}
+	if f.Action != "" {
+		w.add("action = %s", f.Action)
+	}
+	if f.RequestID != "" {
+		w.add("request_id = %s", f.RequestID)
+	}
+	if f.CreatedAfter.Valid {
+		w.add("created_at >= %s", f.CreatedAfter)
+	}
+	if f.CreatedBefore.Valid {
+		w.add("created_at < %s", f.CreatedBefore)
+	}
+}
+
+func (arg ListAuditParams) query() (string, []any) {
+	var w where
+	arg.Filter.apply(&w)
+	if arg.BeforeID != 0 {
+		w.add("id < %s", arg.BeforeID)
+	}
+	sql := listAudit + w.sql() + "\nORDER BY id DESC LIMIT " + w.arg(arg.Limit)
+	return sql, w.args
+}
+
+func (q *Queries) ListAudit(ctx context.Context, arg ListAuditParams) ([]AuditLog, error) {
+	sql, args := arg.query()
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Action,
+			&i.Actor,
+			&i.RequestID,
+			&i.Before,
+			&i.After,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListAuditParams_query(t *testing.T) {
+	tests := []struct {
+		name         string
+		givenParams  ListAuditParams
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "no filter",
+			givenParams:  ListAuditParams{Limit: 10},
+			expectedSQL:  listAudit + "\nORDER BY id DESC LIMIT $1",
+			expectedArgs: []any{int32(10)},
+		},
+		{
+			name: "user and actor before id",
+			givenParams: ListAuditParams{
+				Filter:   AuditFilter{UserID: 7, Actor: "admin"},
+				BeforeID: 42,
+				Limit:    10,
+			},
+			expectedSQL:  listAudit + "\nWHERE user_id = $1 AND actor = $2 AND id < $3\nORDER BY id DESC LIMIT $4",
+			expectedArgs: []any{int64(7), "admin", int64(42), int32(10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.givenParams.query()
+			if sql != tt.expectedSQL {
+				t.Errorf("query() sql = %q, want %q", sql, tt.expectedSQL)
+			}
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("query() args = %#v, want %#v", args, tt.expectedArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package db
+
+import "context"
+
+// CopyUsersAtomic inserts users with COPY in a single transaction and
+// returns them, so either all users are created or none. Names must be
+// distinct.
+func (q *Queries) CopyUsersAtomic(ctx context.Context, params []CopyUsersParams, audit Audit) ([]User, error) {
+	var users []User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		if _, err := qtx.CopyUsers(ctx, params); err != nil {
+			return err
+		}
+		names := make([]string, len(params))
+		for i, p := range params {
+			names[i] = p.Name
+		}
+		var err error
+		if users, err = qtx.GetUsersByNames(ctx, names); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditCreate, created(users))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUsersAudited inserts users like CreateUsers and records those
+// created.
+func (q *Queries) CreateUsersAudited(ctx context.Context, arg CreateUsersParams, audit Audit) ([]User, error) {
+	var users []User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		var err error
+		if users, err = qtx.CreateUsers(ctx, arg); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditCreate, created(users))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpsertUsersAudited upserts users like UpsertUsers. It locks the existing
+// users first to take their rows before the update, and records created
+// and updated users apart.
+func (q *Queries) UpsertUsersAudited(ctx context.Context, arg UpsertUsersParams, audit Audit) ([]User, error) {
+	var users []User
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		snapshots, err := qtx.GetUserSnapshotsByNames(ctx, arg.Names)
+		if err != nil {
+			return err
+		}
+		befores := make(map[int64][]byte, len(snapshots))
+		for _, s := range snapshots {
+			befores[s.ID] = s.Snapshot
+		}
+		if users, err = qtx.UpsertUsers(ctx, arg); err != nil {
+			return err
+		}
+		var inserted, updated changes
+		for _, user := range users {
+			// Only updated users have updated_at set by the statement.
+			if user.UpdatedAt.Valid {
+				updated.add(user.ID, befores[user.ID])
+			} else {
+				inserted.add(user.ID, nil)
+			}
+		}
+		if err := qtx.record(ctx, audit, AuditCreate, inserted); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, AuditUpdate, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
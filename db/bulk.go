@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// lockUsers selects and locks the users a bulk change applies to. It is
+// built at runtime like ListUsers, as is countBulkUsers counting them.
+const (
+	lockUsers      = "-- name: LockUsers :many\nSELECT id, to_jsonb(users) FROM users"
+	countBulkUsers = "-- name: CountBulkUsers :one\nSELECT count(*) FROM users"
+)
+
+// ErrTooManyRows aborts a bulk change selecting more than MaxRows users.
+var ErrTooManyRows = errors.New("too many rows")
+
+// BulkParams selects the users of a bulk change by IDs when not nil, or by
+// Filter otherwise.
+type BulkParams struct {
+	IDs    []int64
+	Filter UserFilter
+	// MaxRows aborts the change with ErrTooManyRows when more users are
+	// selected.
+	MaxRows int32
+	// DryRun selects at most MaxRows users without locking or changing
+	// them, never aborting.
+	DryRun bool
+}
+
+// BulkSetUsersOther sets other of the selected users in one transaction,
+// recorded as updates, and returns their ids.
+func (q *Queries) BulkSetUsersOther(ctx context.Context, params BulkParams, other pgtype.Text, audit Audit) ([]int64, error) {
+	return q.bulk(ctx, params, audit, AuditUpdate, func(qtx *Queries, ids []int64) error {
+		_, err := qtx.SetUsersOther(ctx, SetUsersOtherParams{Other: other, Ids: ids})
+		return err
+	})
+}
+
+// BulkDeleteUsers soft deletes the selected users in one transaction,
+// recorded as deletes, and returns their ids.
+func (q *Queries) BulkDeleteUsers(ctx context.Context, params BulkParams, audit Audit) ([]int64, error) {
+	return q.bulk(ctx, params, audit, AuditDelete, func(qtx *Queries, ids []int64) error {
+		_, err := qtx.DeleteUsers(ctx, ids)
+		return err
+	})
+}
+
+func (q *Queries) bulk(ctx context.Context, params BulkParams, audit Audit, action string, change func(*Queries, []int64) error) ([]int64, error) {
+	var locked changes
+	err := q.inTx(ctx, func(qtx *Queries) error {
+		var err error
+		locked, err = qtx.lockUsers(ctx, params)
+		if err != nil {
+			return err
+		}
+		if params.DryRun || len(locked.ids) == 0 {
+			return nil
+		}
+		if len(locked.ids) > int(params.MaxRows) {
+			return ErrTooManyRows
+		}
+		if err := change(qtx, locked.ids); err != nil {
+			return err
+		}
+		return qtx.record(ctx, audit, action, locked)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locked.ids, nil
+}
+
+// lockUsers returns the selected users with their rows before the change.
+func (q *Queries) lockUsers(ctx context.Context, params BulkParams) (changes, error) {
+	sql, args := params.query()
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return changes{}, err
+	}
+	defer rows.Close()
+	locked := changes{ids: []int64{}}
+	for rows.Next() {
+		var id int64
+		var before []byte
+		if err := rows.Scan(&id, &before); err != nil {
+			return changes{}, err
+		}
+		locked.add(id, before)
+	}
+	if err := rows.Err(); err != nil {
+		return changes{}, err
+	}
+	return locked, nil
+}
+
+// CountBulkUsers counts all the users selected by params, without locking
+// them, so that a dry run tells how many a change would exceed MaxRows by.
+func (q *Queries) CountBulkUsers(ctx context.Context, params BulkParams) (int64, error) {
+	w := params.where()
+	var count int64
+	err := q.db.QueryRow(ctx, countBulkUsers+w.sql(), w.args...).Scan(&count)
+	return count, err
+}
+
+// query selects one user over MaxRows, so exceeding it is detected without
+// locking every matching user. A dry run selects up to MaxRows unlocked.
+func (p BulkParams) query() (string, []any) {
+	w := p.where()
+	if p.DryRun {
+		return lockUsers + w.sql() + "\nORDER BY id LIMIT " + w.arg(p.MaxRows), w.args
+	}
+	sql := lockUsers + w.sql() + "\nORDER BY id LIMIT " + w.arg(p.MaxRows+1) + " FOR UPDATE"
+	return sql, w.args
+}
+
+func (p BulkParams) where() where {
+	var w where
+	p.Filter.apply(&w)
+	if p.IDs != nil {
+		w.add("id = ANY(%s)", p.IDs)
+	}
+	return w
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBulkParams_query(t *testing.T) {
+	tests := []struct {
+		name         string
+		givenParams  BulkParams
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "ids",
+			givenParams:  BulkParams{IDs: []int64{1, 2}, MaxRows: 10},
+			expectedSQL:  lockUsers + "\nWHERE deleted_at IS NULL AND id = ANY($1)\nORDER BY id LIMIT $2 FOR UPDATE",
+			expectedArgs: []any{[]int64{1, 2}, int32(11)},
+		},
+		{
+			name:         "filter",
+			givenParams:  BulkParams{Filter: UserFilter{NamePrefix: "adm"}, MaxRows: 10},
+			expectedSQL:  lockUsers + "\nWHERE deleted_at IS NULL AND name LIKE $1\nORDER BY id LIMIT $2 FOR UPDATE",
+			expectedArgs: []any{"adm%", int32(11)},
+		},
+		{
+			name:         "dry run",
+			givenParams:  BulkParams{Filter: UserFilter{NamePrefix: "adm"}, MaxRows: 10, DryRun: true},
+			expectedSQL:  lockUsers + "\nWHERE deleted_at IS NULL AND name LIKE $1\nORDER BY id LIMIT $2",
+			expectedArgs: []any{"adm%", int32(10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.givenParams.query()
+			if sql != tt.expectedSQL {
+				t.Errorf("query() sql = %q, want %q", sql, tt.expectedSQL)
+			}
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("query() args = %#v, want %#v", args, tt.expectedArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: copyfrom.go
+
+package db
+
+import (
+	"context"
+)
+
+// iteratorForCopyUsers implements pgx.CopyFromSource.
+type iteratorForCopyUsers struct {
+	rows                 []CopyUsersParams
+	skippedFirstNextCall bool
+}
+
+func (r *iteratorForCopyUsers) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	if !r.skippedFirstNextCall {
+		r.skippedFirstNextCall = true
+		return true
+	}
+	r.rows = r.rows[1:]
+	return len(r.rows) > 0
+}
+
+func (r iteratorForCopyUsers) Values() ([]interface{}, error) {
+	return []interface{}{
+		r.rows[0].Name,
+		r.rows[0].Other,
+	}, nil
+}
+
+func (r iteratorForCopyUsers) Err() error {
+	return nil
+}
+
+func (q *Queries) CopyUsers(ctx context.Context, arg []CopyUsersParams) (int64, error) {
+	return q.db.CopyFrom(ctx, []string{"users"}, []string{"name", "other"}, &iteratorForCopyUsers{rows: arg})
+}
@@ -0,0 +1,33 @@
+package db
+
+import "context"
+
+const exportUsers = "-- name: ExportUsers :many\nSELECT id, name, other, created_at, updated_at, version, deleted_at FROM users"
+
+// ExportUsers passes users matching filter to fn in id order. Rows are read
+// from the connection as fn consumes them, so memory does not grow with the
+// number of users. An error of fn stops the export and is returned.
+func (q *Queries) ExportUsers(ctx context.Context, filter UserFilter, fn func(User) error) error {
+	sql, args := exportQuery(filter)
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportQuery(filter UserFilter) (string, []any) {
+	var w where
+	filter.apply(&w)
+	return exportUsers + w.sql() + "\nORDER BY id", w.args
+}
@@ -0,0 +1,16 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_exportQuery(t *testing.T) {
+	sql, args := exportQuery(UserFilter{Name: "kapitan"})
+	if expected := exportUsers + "\nWHERE deleted_at IS NULL AND name = $1\nORDER BY id"; sql != expected {
+		t.Errorf("exportQuery() sql = %q, want %q", sql, expected)
+	}
+	if expected := []any{"kapitan"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("exportQuery() args = %#v, want %#v", args, expected)
+	}
+}
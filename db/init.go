@@ -2,34 +2,116 @@ package db
 
 import (
 	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func InitDB(ctx context.Context, postgresUrl string) (*pgx.Conn, error) {
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var ErrSchemaDirty = errors.New("schema is dirty")
+var ErrSchemaVersionMismatch = errors.New("schema version mismatch")
+
+func InitDB(ctx context.Context, postgresUrl string, poolConfig PoolConfig) (*pgxpool.Pool, error) {
 	err := migrateUp(postgresUrl)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := pgx.Connect(ctx, postgresUrl)
+	config, err := pgxpool.ParseConfig(postgresUrl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing postgres url: %w", err)
+	}
+	poolConfig.apply(config)
+	config.ConnConfig.Tracer = queryTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	return conn, nil
+	return pool, nil
 }
 
 func migrateUp(postgresUrl string) error {
-	m, err := migrate.New(
-		"file://db/migrations",
-		postgresUrl)
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, postgresUrl)
 	if err != nil {
 		return err
 	}
+	expected, err := ExpectedSchemaVersion()
+	if err != nil {
+		return err
+	}
+	// A newer release may have migrated the schema already, which has no
+	// migration embedded in this one to go up from.
+	if version, dirty, err := m.Version(); err == nil && !dirty && version > expected {
+		slog.Warn("schema newer than expected, not migrating", "version", version, "expected", expected)
+		return nil
+	}
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
 		return err
 	}
 	return nil
 }
+
+// ExpectedSchemaVersion returns the latest migration version embedded
+// in the binary.
+func ExpectedSchemaVersion() (uint, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return 0, err
+	}
+	var version uint
+	for _, e := range entries {
+		m, err := source.DefaultParse(e.Name())
+		if err != nil {
+			return 0, fmt.Errorf("parsing migration %s: %w", e.Name(), err)
+		}
+		version = max(version, m.Version)
+	}
+	return version, nil
+}
+
+const schemaVersion = `-- name: SchemaVersion :one
+SELECT version, dirty FROM schema_migrations LIMIT 1
+`
+
+// CheckSchemaVersion verifies that the schema version recorded by
+// golang-migrate is at least ExpectedSchemaVersion. A newer schema, migrated
+// by a newer release during a rolling deploy, is only logged, as
+// migrations keep the schema compatible with the previous release.
+func CheckSchemaVersion(ctx context.Context, db DBTX) error {
+	expected, err := ExpectedSchemaVersion()
+	if err != nil {
+		return err
+	}
+	var version int64
+	var dirty bool
+	if err := db.QueryRow(ctx, schemaVersion).Scan(&version, &dirty); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: no migrations applied, expected %d", ErrSchemaVersionMismatch, expected)
+		}
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("%w: version %d", ErrSchemaDirty, version)
+	}
+	if uint(version) < expected {
+		return fmt.Errorf("%w: got %d, expected %d", ErrSchemaVersionMismatch, version, expected)
+	}
+	if uint(version) > expected {
+		slog.WarnContext(ctx, "schema newer than expected", "version", version, "expected", expected)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestExpectedSchemaVersion(t *testing.T) {
+	version, err := ExpectedSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version == 0 {
+		t.Error("ExpectedSchemaVersion() = 0, want latest migration version")
+	}
+}
+
+// schemaVersionDB records version in schema_migrations, it only reads it.
+type schemaVersionDB struct {
+	DBTX
+	version int64
+	dirty   bool
+}
+
+func (db schemaVersionDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return db
+}
+
+func (db schemaVersionDB) Scan(dest ...any) error {
+	*dest[0].(*int64), *dest[1].(*bool) = db.version, db.dirty
+	return nil
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	expected, err := ExpectedSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		db          schemaVersionDB
+		expectedErr error
+	}{
+		{"expected", schemaVersionDB{version: int64(expected)}, nil},
+		{"newer", schemaVersionDB{version: int64(expected) + 1}, nil},
+		{"older", schemaVersionDB{version: int64(expected) - 1}, ErrSchemaVersionMismatch},
+		{"dirty", schemaVersionDB{version: int64(expected), dirty: true}, ErrSchemaDirty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSchemaVersion(context.Background(), tt.db)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("CheckSchemaVersion() error = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
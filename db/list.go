@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Listing queries are built at runtime because filters are optional, so
+// they are written by hand instead of generated by sqlc. They keep the sqlc
+// name comment for query metrics and spans.
+
+const (
+	listUsers  = "-- name: ListUsers :many\nSELECT id, name, other, created_at, updated_at, version, deleted_at FROM users"
+	countUsers = "-- name: CountUsers :one\nSELECT count(*) FROM users"
+	// Users as of a time are read from their history under the same names.
+	listUsersAsOf  = "-- name: ListUsers :many\nSELECT id, name, other, created_at, updated_at, version, deleted_at FROM users_history"
+	countUsersAsOf = "-- name: CountUsers :one\nSELECT count(*) FROM users_history"
+)
+
+// UserFilter narrows listed and counted users. Zero fields do not filter,
+// except that deleted users are excluded unless IncludeDeleted is set.
+// Time ranges are half-open: after is inclusive, before is exclusive.
+type UserFilter struct {
+	Name          string
+	NamePrefix    string
+	CreatedAfter  pgtype.Timestamp
+	CreatedBefore pgtype.Timestamp
+	UpdatedAfter  pgtype.Timestamp
+	UpdatedBefore pgtype.Timestamp
+	// UpdatedSince matches users created or updated since the time.
+	UpdatedSince pgtype.Timestamp
+	HasOther     pgtype.Bool
+	// IncludeDeleted includes soft deleted users.
+	IncludeDeleted bool
+	// AsOf selects users as they were at the time. Only ListUsers and
+	// CountUsers read the history.
+	AsOf pgtype.Timestamp
+}
+
+// Sort columns users can be ordered by. SortUpdatedAt orders users never
+// updated by their creation time.
+const (
+	SortID        = "id"
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+)
+
+var sortExprs = map[string]string{
+	SortID:        "id",
+	SortName:      "name",
+	SortCreatedAt: "created_at",
+	SortUpdatedAt: "coalesce(updated_at, created_at)",
+}
+
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// UserKey holds the sort column values of a user that a page starts after.
+type UserKey struct {
+	ID        int64
+	Name      string
+	CreatedAt pgtype.Timestamp
+	// UpdatedAt falls back to CreatedAt like SortUpdatedAt.
+	UpdatedAt pgtype.Timestamp
+}
+
+func KeyOf(user User) UserKey {
+	updatedAt := user.UpdatedAt
+	if !updatedAt.Valid {
+		updatedAt = user.CreatedAt
+	}
+	return UserKey{
+		ID:        user.ID,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: updatedAt,
+	}
+}
+
+func (k UserKey) value(column string) any {
+	switch column {
+	case SortName:
+		return k.Name
+	case SortCreatedAt:
+		return k.CreatedAt
+	case SortUpdatedAt:
+		return k.UpdatedAt
+	}
+	return k.ID
+}
+
+type ListUsersParams struct {
+	Filter UserFilter
+	// Sort defaults to created_at. Users are always ordered by id last, so
+	// the order is stable.
+	Sort []SortKey
+	// Key selects users following the key in sort order.
+	Key *UserKey
+	// Backward reverses the sort order, so users preceding Key are selected,
+	// or the last users without Key.
+	Backward bool
+	Limit    int32
+	Offset   int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	sql, args, err := arg.query()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		i, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func scanUser(rows pgx.Rows) (User, error) {
+	var i User
+	err := rows.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Other,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+func (q *Queries) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	var w where
+	filter.apply(&w)
+	sql := countUsers
+	if filter.AsOf.Valid {
+		sql = countUsersAsOf
+	}
+	row := q.db.QueryRow(ctx, sql+w.sql(), w.args...)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+func (arg ListUsersParams) query() (string, []any, error) {
+	keys, err := orderKeys(arg.Sort, arg.Backward)
+	if err != nil {
+		return "", nil, err
+	}
+	var w where
+	arg.Filter.apply(&w)
+	if arg.Key != nil {
+		w.conds = append(w.conds, keyset(keys, *arg.Key, &w))
+	}
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		order[i] = sortExprs[k.Column]
+		if k.Desc {
+			order[i] += " DESC"
+		}
+	}
+	sql := listUsers
+	if arg.Filter.AsOf.Valid {
+		sql = listUsersAsOf
+	}
+	sql += w.sql() + "\nORDER BY " + strings.Join(order, ", ") +
+		" LIMIT " + w.arg(arg.Limit) + " OFFSET " + w.arg(arg.Offset)
+	return sql, w.args, nil
+}
+
+// orderKeys validates sort and appends the id tiebreaker in the direction of
+// the last key, so that single direction sorts can use the indexes.
+func orderKeys(sort []SortKey, backward bool) ([]SortKey, error) {
+	if len(sort) == 0 {
+		sort = []SortKey{{Column: SortCreatedAt}}
+	}
+	keys := make([]SortKey, 0, len(sort)+1)
+	for _, k := range sort {
+		if _, ok := sortExprs[k.Column]; !ok {
+			return nil, fmt.Errorf("unknown sort column %q", k.Column)
+		}
+		keys = append(keys, k)
+		if k.Column == SortID {
+			break
+		}
+	}
+	if last := keys[len(keys)-1]; last.Column != SortID {
+		keys = append(keys, SortKey{Column: SortID, Desc: last.Desc})
+	}
+	if backward {
+		for i := range keys {
+			keys[i].Desc = !keys[i].Desc
+		}
+	}
+	return keys, nil
+}
+
+// keyset returns the condition selecting rows following key in keys order.
+// A row comparison is used when all keys share direction so that indexes
+// apply, otherwise comparisons are expanded column by column.
+func keyset(keys []SortKey, key UserKey, w *where) string {
+	exprs := make([]string, len(keys))
+	values := make([]string, len(keys))
+	uniform := true
+	for i, k := range keys {
+		exprs[i] = sortExprs[k.Column]
+		values[i] = w.arg(key.value(k.Column))
+		uniform = uniform && k.Desc == keys[0].Desc
+	}
+	if uniform {
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(exprs, ", "), compare(keys[0]), strings.Join(values, ", "))
+	}
+	ors := make([]string, len(keys))
+	for i, k := range keys {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, exprs[j]+" = "+values[j])
+		}
+		ands = append(ands, exprs[i]+" "+compare(k)+" "+values[i])
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+func compare(k SortKey) string {
+	if k.Desc {
+		return "<"
+	}
+	return ">"
+}
+
+func (f UserFilter) apply(w *where) {
+	if !f.IncludeDeleted {
+		w.add("deleted_at IS NULL")
+	}
+	if f.Name != "" {
+		w.add("name = %s", f.Name)
+	}
+	if f.NamePrefix != "" {
+		w.add("name LIKE %s", escapeLike(f.NamePrefix)+"%")
+	}
+	if f.CreatedAfter.Valid {
+		w.add("created_at >= %s", f.CreatedAfter)
+	}
+	if f.CreatedBefore.Valid {
+		w.add("created_at < %s", f.CreatedBefore)
+	}
+	if f.UpdatedAfter.Valid {
+		w.add("updated_at >= %s", f.UpdatedAfter)
+	}
+	if f.UpdatedBefore.Valid {
+		w.add("updated_at < %s", f.UpdatedBefore)
+	}
+	if f.UpdatedSince.Valid {
+		w.add("coalesce(updated_at, created_at) >= %s", f.UpdatedSince)
+	}
+	if f.HasOther.Valid {
+		if f.HasOther.Bool {
+			w.add("coalesce(other, '') <> ''")
+		} else {
+			w.add("coalesce(other, '') = ''")
+		}
+	}
+	if f.AsOf.Valid {
+		w.add("valid_from <= %s AND (valid_to IS NULL OR valid_to > %s)", f.AsOf, f.AsOf)
+	}
+}
+
+// where collects AND-ed conditions with their positional arguments.
+type where struct {
+	conds []string
+	args  []any
+}
+
+// add appends a condition, replacing each %s with a placeholder of a value.
+func (w *where) add(format string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, v := range values {
+		placeholders[i] = w.arg(v)
+	}
+	w.conds = append(w.conds, fmt.Sprintf(format, placeholders...))
+}
+
+func (w *where) arg(v any) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *where) sql() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return "\nWHERE " + strings.Join(w.conds, " AND ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestListUsersParams_query_UnknownSortColumn(t *testing.T) {
+	params := ListUsersParams{Sort: []SortKey{{Column: "other; DROP TABLE users"}}, Limit: 10}
+	if _, _, err := params.query(); err == nil {
+		t.Error("query() error = nil, want unknown sort column")
+	}
+}
+
+func TestListUsersParams_query(t *testing.T) {
+	ts := pgtype.Timestamp{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true}
+	tests := []struct {
+		name         string
+		givenParams  ListUsersParams
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "no filter",
+			givenParams:  ListUsersParams{Limit: 10, Offset: 20},
+			expectedSQL:  listUsers + "\nWHERE deleted_at IS NULL\nORDER BY created_at, id LIMIT $1 OFFSET $2",
+			expectedArgs: []any{int32(10), int32(20)},
+		},
+		{
+			name:         "include deleted",
+			givenParams:  ListUsersParams{Filter: UserFilter{IncludeDeleted: true}, Limit: 10},
+			expectedSQL:  listUsers + "\nORDER BY created_at, id LIMIT $1 OFFSET $2",
+			expectedArgs: []any{int32(10), int32(0)},
+		},
+		{
+			name: "filters",
+			givenParams: ListUsersParams{
+				Filter: UserFilter{
+					NamePrefix:   "a_b%",
+					CreatedAfter: ts,
+					UpdatedSince: ts,
+					HasOther:     pgtype.Bool{Bool: true, Valid: true},
+				},
+				Limit: 10,
+			},
+			expectedSQL: listUsers + "\nWHERE deleted_at IS NULL AND name LIKE $1 AND created_at >= $2 AND coalesce(updated_at, created_at) >= $3 AND coalesce(other, '') <> ''" +
+				"\nORDER BY created_at, id LIMIT $4 OFFSET $5",
+			expectedArgs: []any{`a\_b\%%`, ts, ts, int32(10), int32(0)},
+		},
+		{
+			name: "backward from key",
+			givenParams: ListUsersParams{
+				Filter:   UserFilter{Name: "name"},
+				Key:      &UserKey{CreatedAt: ts, ID: 7},
+				Backward: true,
+				Limit:    10,
+			},
+			expectedSQL: listUsers + "\nWHERE deleted_at IS NULL AND name = $1 AND (created_at, id) < ($2, $3)" +
+				"\nORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5",
+			expectedArgs: []any{"name", ts, int64(7), int32(10), int32(0)},
+		},
+		{
+			name: "uniform sort from key",
+			givenParams: ListUsersParams{
+				Sort:  []SortKey{{Column: SortUpdatedAt, Desc: true}},
+				Key:   &UserKey{UpdatedAt: ts, ID: 7},
+				Limit: 10,
+			},
+			expectedSQL: listUsers + "\nWHERE deleted_at IS NULL AND (coalesce(updated_at, created_at), id) < ($1, $2)" +
+				"\nORDER BY coalesce(updated_at, created_at) DESC, id DESC LIMIT $3 OFFSET $4",
+			expectedArgs: []any{ts, int64(7), int32(10), int32(0)},
+		},
+		{
+			name: "mixed sort from key",
+			givenParams: ListUsersParams{
+				Sort:  []SortKey{{Column: SortName}, {Column: SortCreatedAt, Desc: true}},
+				Key:   &UserKey{Name: "name", CreatedAt: ts, ID: 7},
+				Limit: 10,
+			},
+			expectedSQL: listUsers + "\nWHERE deleted_at IS NULL AND ((name > $1) OR (name = $1 AND created_at < $2) OR (name = $1 AND created_at = $2 AND id < $3))" +
+				"\nORDER BY name, created_at DESC, id DESC LIMIT $4 OFFSET $5",
+			expectedArgs: []any{"name", ts, int64(7), int32(10), int32(0)},
+		},
+		{
+			name: "sort by id needs no tiebreaker",
+			givenParams: ListUsersParams{
+				Sort:  []SortKey{{Column: SortID, Desc: true}, {Column: SortName}},
+				Limit: 10,
+			},
+			expectedSQL:  listUsers + "\nWHERE deleted_at IS NULL\nORDER BY id DESC LIMIT $1 OFFSET $2",
+			expectedArgs: []any{int32(10), int32(0)},
+		},
+		{
+			name: "as of a time",
+			givenParams: ListUsersParams{
+				Filter: UserFilter{AsOf: ts},
+				Limit:  10,
+			},
+			expectedSQL:  listUsersAsOf + "\nWHERE deleted_at IS NULL AND valid_from <= $1 AND (valid_to IS NULL OR valid_to > $2)\nORDER BY created_at, id LIMIT $3 OFFSET $4",
+			expectedArgs: []any{ts, ts, int32(10), int32(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.givenParams.query()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.expectedSQL {
+				t.Errorf("query() sql = %v, want %v", sql, tt.expectedSQL)
+			}
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("query() args = %v, want %v", args, tt.expectedArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_updated_at_id;
+DROP INDEX IF EXISTS users_name_id;
@@ -0,0 +1,2 @@
+CREATE INDEX users_name_id ON users (name, id);
+CREATE INDEX users_updated_at_id ON users ((coalesce(updated_at, created_at)), id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_search;
+DROP INDEX IF EXISTS users_name_trgm;
@@ -0,0 +1,5 @@
+-- Deleted users are purged, as their names may be taken by live users.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS users_name_live;
+ALTER TABLE users ADD CONSTRAINT users_name UNIQUE (name);
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN deleted_at timestamp;
+ALTER TABLE users DROP CONSTRAINT users_name;
+CREATE UNIQUE INDEX users_name_live ON users (name) WHERE deleted_at IS NULL;
@@ -0,0 +1,14 @@
+-- No foreign key to users, so the history of purged users is kept.
+CREATE TABLE audit_log (
+  id         BIGSERIAL PRIMARY KEY,
+  user_id    bigint    NOT NULL,
+  action     text      NOT NULL,
+  actor      text      NOT NULL,
+  request_id text,
+  before     jsonb,
+  after      jsonb,
+  created_at timestamp NOT NULL
+);
+
+CREATE INDEX audit_log_user_id_id ON audit_log (user_id, id);
+CREATE INDEX audit_log_created_at ON audit_log (created_at);
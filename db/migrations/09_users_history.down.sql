@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_history_write ON users;
+DROP FUNCTION IF EXISTS users_history_write();
+DROP TABLE IF EXISTS users_history;
@@ -0,0 +1,42 @@
+-- users_history keeps every version of a user, valid from valid_from
+-- until valid_to, or until now when valid_to is NULL. It is maintained by
+-- a trigger, so that every write is recorded.
+CREATE TABLE users_history (
+  id         bigint    NOT NULL,
+  name       text      NOT NULL,
+  other      text,
+  created_at timestamp NOT NULL,
+  updated_at timestamp,
+  version    bigint    NOT NULL,
+  deleted_at timestamp,
+  valid_from timestamp NOT NULL,
+  valid_to   timestamp
+);
+
+CREATE INDEX users_history_id_valid_from ON users_history (id, valid_from);
+CREATE INDEX users_history_valid_from ON users_history (valid_from);
+
+-- Versions written before the history existed are valid since their last
+-- change.
+INSERT INTO users_history (id, name, other, created_at, updated_at, version, deleted_at, valid_from)
+SELECT id, name, other, created_at, updated_at, version, deleted_at,
+  greatest(coalesce(updated_at, created_at), deleted_at)
+FROM users;
+
+CREATE FUNCTION users_history_write() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    UPDATE users_history SET valid_to = now()
+    WHERE id = OLD.id AND valid_to IS NULL;
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    INSERT INTO users_history (id, name, other, created_at, updated_at, version, deleted_at, valid_from)
+    VALUES (NEW.id, NEW.name, NEW.other, NEW.created_at, NEW.updated_at, NEW.version, NEW.deleted_at, now());
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_history_write
+AFTER INSERT OR UPDATE OR DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION users_history_write();
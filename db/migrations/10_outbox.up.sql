@@ -0,0 +1,16 @@
+-- outbox holds events written with the change they describe, published by
+-- the relay at least once, in order per user.
+CREATE TABLE outbox (
+  id              BIGSERIAL PRIMARY KEY,
+  user_id         bigint    NOT NULL,
+  event_type      text      NOT NULL,
+  payload         jsonb     NOT NULL,
+  request_id      text,
+  created_at      timestamp NOT NULL,
+  attempts        integer   NOT NULL DEFAULT 0,
+  last_error      text,
+  next_attempt_at timestamp NOT NULL,
+  published_at    timestamp
+);
+
+CREATE INDEX outbox_pending ON outbox (user_id, id) WHERE published_at IS NULL;
@@ -0,0 +1,24 @@
+-- An empty event_types subscribes to every event.
+CREATE TABLE webhooks (
+  id          BIGSERIAL PRIMARY KEY,
+  url         text      NOT NULL,
+  event_types text[]    NOT NULL,
+  secret      text      NOT NULL,
+  created_at  timestamp NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+  id               BIGSERIAL PRIMARY KEY,
+  webhook_id       bigint    NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  event_id         bigint    NOT NULL REFERENCES outbox (id),
+  status           text      NOT NULL,
+  attempts         integer   NOT NULL DEFAULT 0,
+  last_status_code integer,
+  last_error       text,
+  next_attempt_at  timestamp NOT NULL,
+  created_at       timestamp NOT NULL,
+  delivered_at     timestamp
+);
+
+CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id_id ON webhook_deliveries (webhook_id, id);
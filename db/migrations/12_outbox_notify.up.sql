@@ -0,0 +1,12 @@
+-- Notifies listeners of the id of every event written to the outbox, sent
+-- when the transaction writing it commits.
+CREATE FUNCTION outbox_notify() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('user_events', NEW.id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER outbox_notify
+AFTER INSERT ON outbox
+FOR EACH ROW EXECUTE FUNCTION outbox_notify();
@@ -0,0 +1,26 @@
+-- position orders events as they are seen committed, so that a client
+-- resuming the event stream after a position misses no event, which ids
+-- taken before commit cannot do. It is null until assigned after commit.
+ALTER TABLE outbox ADD COLUMN position bigint;
+
+UPDATE outbox SET position = p.position
+FROM (SELECT id, row_number() OVER (ORDER BY id) AS position FROM outbox) p
+WHERE outbox.id = p.id;
+
+CREATE UNIQUE INDEX outbox_position ON outbox (position);
+CREATE INDEX outbox_unpositioned ON outbox (id) WHERE position IS NULL;
+
+-- Only the sequencer listens to events being written, once per statement,
+-- and notifies user_events once it assigned them positions.
+DROP TRIGGER outbox_notify ON outbox;
+
+CREATE OR REPLACE FUNCTION outbox_notify() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('outbox_written', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER outbox_notify
+AFTER INSERT ON outbox
+FOR EACH STATEMENT EXECUTE FUNCTION outbox_notify();
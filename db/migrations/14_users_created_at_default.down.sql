@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN created_at DROP DEFAULT;
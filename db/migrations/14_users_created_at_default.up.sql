@@ -0,0 +1,3 @@
+-- Users copied in bulk take created_at from the database clock like those
+-- inserted one by one.
+ALTER TABLE users ALTER COLUMN created_at SET DEFAULT now();
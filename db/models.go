@@ -8,10 +8,70 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditLog struct {
+	ID        int64
+	UserID    int64
+	Action    string
+	Actor     string
+	RequestID pgtype.Text
+	Before    []byte
+	After     []byte
+	CreatedAt pgtype.Timestamp
+}
+
+type Outbox struct {
+	ID            int64
+	UserID        int64
+	EventType     string
+	Payload       []byte
+	RequestID     pgtype.Text
+	CreatedAt     pgtype.Timestamp
+	Attempts      int32
+	LastError     pgtype.Text
+	NextAttemptAt pgtype.Timestamp
+	PublishedAt   pgtype.Timestamp
+	Position      pgtype.Int8
+}
+
 type User struct {
 	ID        int64
 	Name      string
 	Other     pgtype.Text
 	CreatedAt pgtype.Timestamp
 	UpdatedAt pgtype.Timestamp
+	Version   int64
+	DeletedAt pgtype.Timestamp
+}
+
+type UsersHistory struct {
+	ID        int64
+	Name      string
+	Other     pgtype.Text
+	CreatedAt pgtype.Timestamp
+	UpdatedAt pgtype.Timestamp
+	Version   int64
+	DeletedAt pgtype.Timestamp
+	ValidFrom pgtype.Timestamp
+	ValidTo   pgtype.Timestamp
+}
+
+type Webhook struct {
+	ID         int64
+	Url        string
+	EventTypes []string
+	Secret     string
+	CreatedAt  pgtype.Timestamp
+}
+
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	EventID        int64
+	Status         string
+	Attempts       int32
+	LastStatusCode pgtype.Int4
+	LastError      pgtype.Text
+	NextAttemptAt  pgtype.Timestamp
+	CreatedAt      pgtype.Timestamp
+	DeliveredAt    pgtype.Timestamp
 }
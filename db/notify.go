@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventsChannel is notified when events are assigned positions.
+const EventsChannel = "user_events"
+
+// writtenChannel is notified once per statement writing events to the
+// outbox, when its transaction commits. Only the sequencer listens to it.
+const writtenChannel = "outbox_written"
+
+// ErrNotSequencer is returned by SequenceEvents when another instance holds
+// the sequencer lock.
+var ErrNotSequencer = errors.New("another instance sequences events")
+
+type acquirer interface {
+	Acquire(context.Context) (*pgxpool.Conn, error)
+}
+
+// ListenEvents calls fn on every notification of EventsChannel until ctx is
+// done or the connection fails. It takes a connection out of the pool for
+// itself and calls ready once it listens, failing when ready does.
+func (q *Queries) ListenEvents(ctx context.Context, ready func() error, fn func()) error {
+	conn, err := q.hijack(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+EventsChannel); err != nil {
+		return err
+	}
+	if err := ready(); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		fn()
+	}
+}
+
+// SequenceEvents assigns positions to committed events while this instance
+// is the sequencer, until ctx is done or the connection fails. It takes a
+// connection out of the pool holding the sequencer lock, or fails with
+// ErrNotSequencer at once, so that positions are assigned by one instance
+// only. Events are positioned in batches of limit when written and every
+// interval, in id order, and EventsChannel is notified once per batch. An
+// event committed after others were positioned gets a greater position, so
+// the events up to any position never change once read.
+func (q *Queries) SequenceEvents(ctx context.Context, limit int32, interval time.Duration) error {
+	conn, err := q.hijack(ctx)
+	if err != nil {
+		return err
+	}
+	// Closing the connection releases the lock.
+	defer conn.Close(context.Background())
+	qc := New(conn)
+	locked, err := qc.TryLockSequencer(ctx)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return ErrNotSequencer
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+writtenChannel); err != nil {
+		return err
+	}
+	for {
+		if err := qc.sequence(ctx, limit); err != nil {
+			return err
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, interval)
+		_, err := conn.WaitForNotification(waitCtx)
+		cancel()
+		if err != nil && (ctx.Err() != nil || !errors.Is(waitCtx.Err(), context.DeadlineExceeded)) {
+			return err
+		}
+	}
+}
+
+// sequence positions all events without one, a batch per transaction.
+func (q *Queries) sequence(ctx context.Context, limit int32) error {
+	for {
+		var assigned int64
+		err := q.inTx(ctx, func(qtx *Queries) error {
+			var err error
+			if assigned, err = qtx.AssignOutboxPositions(ctx, limit); err != nil || assigned == 0 {
+				return err
+			}
+			return qtx.NotifyOutboxPositions(ctx)
+		})
+		if err != nil || assigned < int64(limit) {
+			return err
+		}
+	}
+}
+
+// hijack takes a connection out of the pool for good, closed by the caller.
+func (q *Queries) hijack(ctx context.Context) (*pgx.Conn, error) {
+	a, ok := q.db.(acquirer)
+	if !ok {
+		return nil, errors.New("listening not supported")
+	}
+	pooled, err := a.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pooled.Hijack(), nil
+}
@@ -0,0 +1,18 @@
+package db
+
+// Event types written to the outbox by the audited writes.
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+	EventUserPurged   = "user.purged"
+)
+
+var auditEvents = map[string]string{
+	AuditCreate:  EventUserCreated,
+	AuditUpdate:  EventUserUpdated,
+	AuditDelete:  EventUserDeleted,
+	AuditRestore: EventUserRestored,
+	AuditPurge:   EventUserPurged,
+}
@@ -1,10 +1,6 @@
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = $1 LIMIT 1;
-
--- name: ListUsers :many
-SELECT * FROM users
-ORDER BY created_at LIMIT $1 OFFSET $2;
+WHERE id = $1 AND (deleted_at IS NULL OR sqlc.arg(include_deleted)::bool) LIMIT 1;
 
 -- name: CreateUser :one
 INSERT INTO users (
@@ -18,10 +14,271 @@ RETURNING *;
 UPDATE users
   set name = $2,
   other = $3,
-  updated_at = now()
-WHERE id = $1
+  updated_at = now(),
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+  AND (sqlc.narg(versions)::bigint[] IS NULL OR version = ANY(sqlc.narg(versions)::bigint[]))
+RETURNING *;
+
+-- name: DeleteUser :execrows
+UPDATE users
+  set deleted_at = now(),
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+  AND (sqlc.narg(versions)::bigint[] IS NULL OR version = ANY(sqlc.narg(versions)::bigint[]));
+
+-- name: RestoreUser :one
+UPDATE users
+  set deleted_at = NULL,
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
 RETURNING *;
 
--- name: DeleteUser :exec
+-- name: PurgeUser :execrows
 DELETE FROM users
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: EstimateUsersCount :one
+SELECT reltuples::bigint AS estimate FROM pg_catalog.pg_class
+WHERE oid = 'users'::regclass;
+
+-- name: SearchUsers :many
+SELECT id, name, other, created_at, updated_at, version,
+  greatest(
+    similarity(name, sqlc.arg(query)::text),
+    word_similarity(sqlc.arg(query)::text, name),
+    -- Normalisation 32 scales the rank to rank / (rank + 1), so that it
+    -- is between 0 and 1 like similarities.
+    ts_rank(to_tsvector('simple', name || ' ' || coalesce(other, '')), plainto_tsquery('simple', sqlc.arg(query)::text), 32)
+  )::real AS score
+FROM users
+WHERE deleted_at IS NULL
+  AND (name % sqlc.arg(query)::text
+    OR sqlc.arg(query)::text <% name
+    OR to_tsvector('simple', name || ' ' || coalesce(other, '')) @@ plainto_tsquery('simple', sqlc.arg(query)::text))
+ORDER BY score DESC, id
+LIMIT sqlc.arg(row_limit);
+
+-- name: CopyUsers :copyfrom
+INSERT INTO users (
+  name, other
+) VALUES (
+  $1, $2
+);
+
+-- name: CreateUsers :many
+INSERT INTO users (name, other, created_at)
+SELECT unnest(sqlc.arg(names)::text[]), unnest(sqlc.arg(others)::text[]), now()
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: GetUsersByNames :many
+SELECT * FROM users
+WHERE name = ANY(sqlc.arg(names)::text[]) AND deleted_at IS NULL;
+
+-- name: SetUsersOther :execrows
+UPDATE users
+  set other = sqlc.narg(other),
+  updated_at = now(),
+  version = version + 1
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: DeleteUsers :execrows
+UPDATE users
+  set deleted_at = now(),
+  version = version + 1
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: UpsertUsers :many
+INSERT INTO users (name, other, created_at)
+SELECT unnest(sqlc.arg(names)::text[]), unnest(sqlc.arg(others)::text[]), now()
+ON CONFLICT (name) WHERE deleted_at IS NULL DO UPDATE
+  set other = excluded.other,
+  updated_at = now(),
+  version = users.version + 1
+RETURNING *;
+
+-- name: GetUserSnapshot :one
+SELECT to_jsonb(u) FROM users u
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CreateAudits :exec
+-- Records the change of each user with its row before, NULL on create, and
+-- after, NULL once purged. Users with neither are not recorded.
+INSERT INTO audit_log (user_id, action, actor, request_id, before, after, created_at)
+SELECT c.user_id, sqlc.arg(action), sqlc.arg(actor), sqlc.narg(request_id), (sqlc.arg(befores)::jsonb[])[c.n], to_jsonb(u), now()
+FROM unnest(sqlc.arg(user_ids)::bigint[]) WITH ORDINALITY AS c (user_id, n)
+LEFT JOIN users u ON u.id = c.user_id
+WHERE u.id IS NOT NULL OR (sqlc.arg(befores)::jsonb[])[c.n] IS NOT NULL
+ORDER BY c.n;
+
+-- name: GetUserSnapshotsByNames :many
+SELECT id, to_jsonb(u) AS snapshot FROM users u
+WHERE name = ANY(sqlc.arg(names)::text[]) AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: GetUserAsOf :one
+SELECT id, name, other, created_at, updated_at, version, deleted_at FROM users_history
+WHERE id = $1
+  AND valid_from <= sqlc.arg(as_of) AND (valid_to IS NULL OR valid_to > sqlc.arg(as_of))
+  AND (deleted_at IS NULL OR sqlc.arg(include_deleted)::bool)
+LIMIT 1;
+
+-- name: CreateOutboxEvents :many
+-- Writes an event of the change of each user in the order given, with its
+-- row after as payload, or before once purged.
+INSERT INTO outbox (user_id, event_type, payload, request_id, created_at, next_attempt_at)
+SELECT c.user_id, sqlc.arg(event_type), coalesce(to_jsonb(u), (sqlc.arg(befores)::jsonb[])[c.n]), sqlc.narg(request_id), now(), now()
+FROM unnest(sqlc.arg(user_ids)::bigint[]) WITH ORDINALITY AS c (user_id, n)
+LEFT JOIN users u ON u.id = c.user_id
+WHERE u.id IS NOT NULL OR (sqlc.arg(befores)::jsonb[])[c.n] IS NOT NULL
+ORDER BY c.n
+RETURNING id;
+
+-- name: ClaimOutboxEvents :many
+-- Leases due events for lease_seconds, after which they are due again,
+-- skipping events of users with an earlier pending event, so that events of
+-- a user are published in order even by concurrent relays.
+UPDATE outbox
+  set next_attempt_at = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+WHERE id IN (
+  SELECT o.id FROM outbox o
+  WHERE o.published_at IS NULL AND o.next_attempt_at <= now()
+    AND NOT EXISTS (
+      SELECT 1 FROM outbox p
+      WHERE p.user_id = o.user_id AND p.published_at IS NULL AND p.id < o.id
+    )
+  ORDER BY o.id
+  LIMIT sqlc.arg(row_limit)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxPublished :exec
+UPDATE outbox
+  set published_at = now(),
+  attempts = attempts + 1,
+  last_error = NULL
+WHERE id = $1 AND published_at IS NULL;
+
+-- name: MarkOutboxFailed :exec
+UPDATE outbox
+  set attempts = attempts + 1,
+  last_error = sqlc.arg(last_error),
+  next_attempt_at = now() + make_interval(secs => sqlc.arg(retry_after_seconds)::float8)
+WHERE id = sqlc.arg(id) AND published_at IS NULL;
+
+-- name: ListUserOutboxEvents :many
+SELECT * FROM outbox
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: CreateWebhook :one
+INSERT INTO webhooks (url, event_types, secret, created_at)
+VALUES ($1, $2, $3, now())
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+ORDER BY id;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
 WHERE id = $1;
+
+-- name: CreateWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at, created_at)
+SELECT w.id, e.id, 'pending', now(), now()
+FROM unnest(sqlc.arg(event_ids)::bigint[]) AS e (id)
+CROSS JOIN webhooks w
+WHERE cardinality(w.event_types) = 0 OR sqlc.arg(event_type)::text = ANY(w.event_types);
+
+-- name: ClaimWebhookDeliveries :many
+-- Leases due deliveries for lease_seconds, after which they are due again.
+WITH claimed AS (
+  UPDATE webhook_deliveries
+    set next_attempt_at = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+  WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at, id
+    LIMIT sqlc.arg(row_limit)
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING id
+)
+SELECT sqlc.embed(d), w.url, w.secret, sqlc.embed(o)
+FROM claimed c
+JOIN webhook_deliveries d ON d.id = c.id
+JOIN webhooks w ON w.id = d.webhook_id
+JOIN outbox o ON o.id = d.event_id;
+
+-- name: MarkDeliveryDelivered :exec
+UPDATE webhook_deliveries
+  set status = 'delivered',
+  attempts = attempts + 1,
+  last_status_code = sqlc.arg(status_code),
+  last_error = NULL,
+  delivered_at = now()
+WHERE id = sqlc.arg(id) AND status = 'pending';
+
+-- name: MarkDeliveryFailed :exec
+-- Moves the delivery to the dead state once it failed max_attempts times.
+UPDATE webhook_deliveries
+  set status = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::integer THEN 'dead' ELSE 'pending' END,
+  attempts = attempts + 1,
+  last_status_code = sqlc.narg(status_code),
+  last_error = sqlc.arg(last_error),
+  next_attempt_at = now() + make_interval(secs => sqlc.arg(retry_after_seconds)::float8)
+WHERE id = sqlc.arg(id) AND status = 'pending';
+
+-- name: ListWebhookDeliveries :many
+SELECT sqlc.embed(d), o.event_type
+FROM webhook_deliveries d
+JOIN outbox o ON o.id = d.event_id
+WHERE d.webhook_id = sqlc.arg(webhook_id)
+  AND (sqlc.narg(status)::text IS NULL OR d.status = sqlc.narg(status))
+  AND (sqlc.narg(before_id)::bigint IS NULL OR d.id < sqlc.narg(before_id))
+ORDER BY d.id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: RedeliverWebhookDelivery :one
+-- Gives the delivery a new round of attempts, whatever its state.
+UPDATE webhook_deliveries
+  set status = 'pending',
+  attempts = 0,
+  next_attempt_at = now()
+WHERE webhook_id = $1 AND id = $2
+RETURNING *;
+
+-- name: TryLockSequencer :one
+SELECT pg_try_advisory_lock(hashtext('outbox_position'));
+
+-- name: AssignOutboxPositions :execrows
+UPDATE outbox o
+SET position = p.position
+FROM (
+  SELECT id, (SELECT coalesce(max(position), 0) FROM outbox) + row_number() OVER (ORDER BY id) AS position
+  FROM outbox
+  WHERE position IS NULL
+  ORDER BY id
+  LIMIT sqlc.arg(row_limit)
+) p
+WHERE o.id = p.id;
+
+-- name: NotifyOutboxPositions :exec
+SELECT pg_notify('user_events', '');
+
+-- name: GetLastOutboxPosition :one
+SELECT coalesce(max(position), 0)::bigint FROM outbox;
+
+-- name: ListOutboxEventsAfter :many
+SELECT * FROM outbox
+WHERE position > sqlc.arg(after_position)::bigint
+ORDER BY position
+LIMIT sqlc.arg(row_limit);
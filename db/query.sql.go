@@ -11,13 +11,247 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const assignOutboxPositions = `-- name: AssignOutboxPositions :execrows
+UPDATE outbox o
+SET position = p.position
+FROM (
+  SELECT id, (SELECT coalesce(max(position), 0) FROM outbox) + row_number() OVER (ORDER BY id) AS position
+  FROM outbox
+  WHERE position IS NULL
+  ORDER BY id
+  LIMIT $1
+) p
+WHERE o.id = p.id
+`
+
+func (q *Queries) AssignOutboxPositions(ctx context.Context, rowLimit int32) (int64, error) {
+	result, err := q.db.Exec(ctx, assignOutboxPositions, rowLimit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const claimOutboxEvents = `-- name: ClaimOutboxEvents :many
+UPDATE outbox
+  set next_attempt_at = now() + make_interval(secs => $1::float8)
+WHERE id IN (
+  SELECT o.id FROM outbox o
+  WHERE o.published_at IS NULL AND o.next_attempt_at <= now()
+    AND NOT EXISTS (
+      SELECT 1 FROM outbox p
+      WHERE p.user_id = o.user_id AND p.published_at IS NULL AND p.id < o.id
+    )
+  ORDER BY o.id
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id, event_type, payload, request_id, created_at, attempts, last_error, next_attempt_at, published_at, position
+`
+
+type ClaimOutboxEventsParams struct {
+	LeaseSeconds float64
+	RowLimit     int32
+}
+
+// Leases due events for lease_seconds, after which they are due again,
+// skipping events of users with an earlier pending event, so that events of
+// a user are published in order even by concurrent relays.
+func (q *Queries) ClaimOutboxEvents(ctx context.Context, arg ClaimOutboxEventsParams) ([]Outbox, error) {
+	rows, err := q.db.Query(ctx, claimOutboxEvents, arg.LeaseSeconds, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EventType,
+			&i.Payload,
+			&i.RequestID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.NextAttemptAt,
+			&i.PublishedAt,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+WITH claimed AS (
+  UPDATE webhook_deliveries
+    set next_attempt_at = now() + make_interval(secs => $1::float8)
+  WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at, id
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING id
+)
+SELECT d.id, d.webhook_id, d.event_id, d.status, d.attempts, d.last_status_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at, w.url, w.secret, o.id, o.user_id, o.event_type, o.payload, o.request_id, o.created_at, o.attempts, o.last_error, o.next_attempt_at, o.published_at, o.position
+FROM claimed c
+JOIN webhook_deliveries d ON d.id = c.id
+JOIN webhooks w ON w.id = d.webhook_id
+JOIN outbox o ON o.id = d.event_id
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseSeconds float64
+	RowLimit     int32
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	WebhookDelivery WebhookDelivery
+	Url             string
+	Secret          string
+	Outbox          Outbox
+}
+
+// Leases due deliveries for lease_seconds, after which they are due again.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, arg.LeaseSeconds, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.WebhookDelivery.ID,
+			&i.WebhookDelivery.WebhookID,
+			&i.WebhookDelivery.EventID,
+			&i.WebhookDelivery.Status,
+			&i.WebhookDelivery.Attempts,
+			&i.WebhookDelivery.LastStatusCode,
+			&i.WebhookDelivery.LastError,
+			&i.WebhookDelivery.NextAttemptAt,
+			&i.WebhookDelivery.CreatedAt,
+			&i.WebhookDelivery.DeliveredAt,
+			&i.Url,
+			&i.Secret,
+			&i.Outbox.ID,
+			&i.Outbox.UserID,
+			&i.Outbox.EventType,
+			&i.Outbox.Payload,
+			&i.Outbox.RequestID,
+			&i.Outbox.CreatedAt,
+			&i.Outbox.Attempts,
+			&i.Outbox.LastError,
+			&i.Outbox.NextAttemptAt,
+			&i.Outbox.PublishedAt,
+			&i.Outbox.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+type CopyUsersParams struct {
+	Name  string
+	Other pgtype.Text
+}
+
+const createAudits = `-- name: CreateAudits :exec
+INSERT INTO audit_log (user_id, action, actor, request_id, before, after, created_at)
+SELECT c.user_id, $1, $2, $3, ($4::jsonb[])[c.n], to_jsonb(u), now()
+FROM unnest($5::bigint[]) WITH ORDINALITY AS c (user_id, n)
+LEFT JOIN users u ON u.id = c.user_id
+WHERE u.id IS NOT NULL OR ($4::jsonb[])[c.n] IS NOT NULL
+ORDER BY c.n
+`
+
+type CreateAuditsParams struct {
+	Action    string
+	Actor     string
+	RequestID pgtype.Text
+	Befores   [][]byte
+	UserIds   []int64
+}
+
+// Records the change of each user with its row before, NULL on create, and
+// after, NULL once purged. Users with neither are not recorded.
+func (q *Queries) CreateAudits(ctx context.Context, arg CreateAuditsParams) error {
+	_, err := q.db.Exec(ctx, createAudits,
+		arg.Action,
+		arg.Actor,
+		arg.RequestID,
+		arg.Befores,
+		arg.UserIds,
+	)
+	return err
+}
+
+const createOutboxEvents = `-- name: CreateOutboxEvents :many
+INSERT INTO outbox (user_id, event_type, payload, request_id, created_at, next_attempt_at)
+SELECT c.user_id, $1, coalesce(to_jsonb(u), ($2::jsonb[])[c.n]), $3, now(), now()
+FROM unnest($4::bigint[]) WITH ORDINALITY AS c (user_id, n)
+LEFT JOIN users u ON u.id = c.user_id
+WHERE u.id IS NOT NULL OR ($2::jsonb[])[c.n] IS NOT NULL
+ORDER BY c.n
+RETURNING id
+`
+
+type CreateOutboxEventsParams struct {
+	EventType string
+	Befores   [][]byte
+	RequestID pgtype.Text
+	UserIds   []int64
+}
+
+// Writes an event of the change of each user in the order given, with its
+// row after as payload, or before once purged.
+func (q *Queries) CreateOutboxEvents(ctx context.Context, arg CreateOutboxEventsParams) ([]int64, error) {
+	rows, err := q.db.Query(ctx, createOutboxEvents,
+		arg.EventType,
+		arg.Befores,
+		arg.RequestID,
+		arg.UserIds,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   name, other, created_at
 ) VALUES (
   $1, $2, now()
 )
-RETURNING id, name, other, created_at, updated_at
+RETURNING id, name, other, created_at, updated_at, version, deleted_at
 `
 
 type CreateUserParams struct {
@@ -34,27 +268,179 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Other,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users
-WHERE id = $1
+const createUsers = `-- name: CreateUsers :many
+INSERT INTO users (name, other, created_at)
+SELECT unnest($1::text[]), unnest($2::text[]), now()
+ON CONFLICT DO NOTHING
+RETURNING id, name, other, created_at, updated_at, version, deleted_at
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
-	_, err := q.db.Exec(ctx, deleteUser, id)
+type CreateUsersParams struct {
+	Names  []string
+	Others []string
+}
+
+func (q *Queries) CreateUsers(ctx context.Context, arg CreateUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, createUsers, arg.Names, arg.Others)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Other,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (url, event_types, secret, created_at)
+VALUES ($1, $2, $3, now())
+RETURNING id, url, event_types, secret, created_at
+`
+
+type CreateWebhookParams struct {
+	Url        string
+	EventTypes []string
+	Secret     string
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRow(ctx, createWebhook, arg.Url, arg.EventTypes, arg.Secret)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.EventTypes,
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWebhookDeliveries = `-- name: CreateWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at, created_at)
+SELECT w.id, e.id, 'pending', now(), now()
+FROM unnest($1::bigint[]) AS e (id)
+CROSS JOIN webhooks w
+WHERE cardinality(w.event_types) = 0 OR $2::text = ANY(w.event_types)
+`
+
+type CreateWebhookDeliveriesParams struct {
+	EventIds  []int64
+	EventType string
+}
+
+func (q *Queries) CreateWebhookDeliveries(ctx context.Context, arg CreateWebhookDeliveriesParams) error {
+	_, err := q.db.Exec(ctx, createWebhookDeliveries, arg.EventIds, arg.EventType)
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+UPDATE users
+  set deleted_at = now(),
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+  AND ($2::bigint[] IS NULL OR version = ANY($2::bigint[]))
+`
+
+type DeleteUserParams struct {
+	ID       int64
+	Versions []int64
+}
+
+func (q *Queries) DeleteUser(ctx context.Context, arg DeleteUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUser, arg.ID, arg.Versions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUsers = `-- name: DeleteUsers :execrows
+UPDATE users
+  set deleted_at = now(),
+  version = version + 1
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) DeleteUsers(ctx context.Context, ids []int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUsers, ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1
+`
+
+func (q *Queries) DeleteWebhook(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebhook, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const estimateUsersCount = `-- name: EstimateUsersCount :one
+SELECT reltuples::bigint AS estimate FROM pg_catalog.pg_class
+WHERE oid = 'users'::regclass
+`
+
+func (q *Queries) EstimateUsersCount(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, estimateUsersCount)
+	var estimate int64
+	err := row.Scan(&estimate)
+	return estimate, err
+}
+
+const getLastOutboxPosition = `-- name: GetLastOutboxPosition :one
+SELECT coalesce(max(position), 0)::bigint FROM outbox
+`
+
+func (q *Queries) GetLastOutboxPosition(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, getLastOutboxPosition)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, name, other, created_at, updated_at FROM users
-WHERE id = $1 LIMIT 1
+SELECT id, name, other, created_at, updated_at, version, deleted_at FROM users
+WHERE id = $1 AND (deleted_at IS NULL OR $2::bool) LIMIT 1
 `
 
-func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
-	row := q.db.QueryRow(ctx, getUser, id)
+type GetUserParams struct {
+	ID             int64
+	IncludeDeleted bool
+}
+
+func (q *Queries) GetUser(ctx context.Context, arg GetUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, arg.ID, arg.IncludeDeleted)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -62,22 +448,102 @@ func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
 		&i.Other,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const listUsers = `-- name: ListUsers :many
-SELECT id, name, other, created_at, updated_at FROM users
-ORDER BY created_at LIMIT $1 OFFSET $2
+const getUserAsOf = `-- name: GetUserAsOf :one
+SELECT id, name, other, created_at, updated_at, version, deleted_at FROM users_history
+WHERE id = $1
+  AND valid_from <= $2 AND (valid_to IS NULL OR valid_to > $2)
+  AND (deleted_at IS NULL OR $3::bool)
+LIMIT 1
 `
 
-type ListUsersParams struct {
-	Limit  int32
-	Offset int32
+type GetUserAsOfParams struct {
+	ID             int64
+	AsOf           pgtype.Timestamp
+	IncludeDeleted bool
 }
 
-func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
-	rows, err := q.db.Query(ctx, listUsers, arg.Limit, arg.Offset)
+type GetUserAsOfRow struct {
+	ID        int64
+	Name      string
+	Other     pgtype.Text
+	CreatedAt pgtype.Timestamp
+	UpdatedAt pgtype.Timestamp
+	Version   int64
+	DeletedAt pgtype.Timestamp
+}
+
+func (q *Queries) GetUserAsOf(ctx context.Context, arg GetUserAsOfParams) (GetUserAsOfRow, error) {
+	row := q.db.QueryRow(ctx, getUserAsOf, arg.ID, arg.AsOf, arg.IncludeDeleted)
+	var i GetUserAsOfRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Other,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserSnapshot = `-- name: GetUserSnapshot :one
+SELECT to_jsonb(u) FROM users u
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserSnapshot(ctx context.Context, id int64) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getUserSnapshot, id)
+	var to_jsonb []byte
+	err := row.Scan(&to_jsonb)
+	return to_jsonb, err
+}
+
+const getUserSnapshotsByNames = `-- name: GetUserSnapshotsByNames :many
+SELECT id, to_jsonb(u) AS snapshot FROM users u
+WHERE name = ANY($1::text[]) AND deleted_at IS NULL
+FOR UPDATE
+`
+
+type GetUserSnapshotsByNamesRow struct {
+	ID       int64
+	Snapshot []byte
+}
+
+func (q *Queries) GetUserSnapshotsByNames(ctx context.Context, names []string) ([]GetUserSnapshotsByNamesRow, error) {
+	rows, err := q.db.Query(ctx, getUserSnapshotsByNames, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSnapshotsByNamesRow
+	for rows.Next() {
+		var i GetUserSnapshotsByNamesRow
+		if err := rows.Scan(&i.ID, &i.Snapshot); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersByNames = `-- name: GetUsersByNames :many
+SELECT id, name, other, created_at, updated_at, version, deleted_at FROM users
+WHERE name = ANY($1::text[]) AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUsersByNames(ctx context.Context, names []string) ([]User, error) {
+	rows, err := q.db.Query(ctx, getUsersByNames, names)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +557,8 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.Other,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Version,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -102,23 +570,475 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	return items, nil
 }
 
+const getWebhook = `-- name: GetWebhook :one
+SELECT id, url, event_types, secret, created_at FROM webhooks
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	row := q.db.QueryRow(ctx, getWebhook, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.EventTypes,
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listOutboxEventsAfter = `-- name: ListOutboxEventsAfter :many
+SELECT id, user_id, event_type, payload, request_id, created_at, attempts, last_error, next_attempt_at, published_at, position FROM outbox
+WHERE position > $1::bigint
+ORDER BY position
+LIMIT $2
+`
+
+type ListOutboxEventsAfterParams struct {
+	AfterPosition int64
+	RowLimit      int32
+}
+
+func (q *Queries) ListOutboxEventsAfter(ctx context.Context, arg ListOutboxEventsAfterParams) ([]Outbox, error) {
+	rows, err := q.db.Query(ctx, listOutboxEventsAfter, arg.AfterPosition, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EventType,
+			&i.Payload,
+			&i.RequestID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.NextAttemptAt,
+			&i.PublishedAt,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserOutboxEvents = `-- name: ListUserOutboxEvents :many
+SELECT id, user_id, event_type, payload, request_id, created_at, attempts, last_error, next_attempt_at, published_at, position FROM outbox
+WHERE user_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListUserOutboxEvents(ctx context.Context, userID int64) ([]Outbox, error) {
+	rows, err := q.db.Query(ctx, listUserOutboxEvents, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EventType,
+			&i.Payload,
+			&i.RequestID,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.NextAttemptAt,
+			&i.PublishedAt,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT d.id, d.webhook_id, d.event_id, d.status, d.attempts, d.last_status_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at, o.event_type
+FROM webhook_deliveries d
+JOIN outbox o ON o.id = d.event_id
+WHERE d.webhook_id = $1
+  AND ($2::text IS NULL OR d.status = $2)
+  AND ($3::bigint IS NULL OR d.id < $3)
+ORDER BY d.id DESC
+LIMIT $4
+`
+
+type ListWebhookDeliveriesParams struct {
+	WebhookID int64
+	Status    pgtype.Text
+	BeforeID  pgtype.Int8
+	RowLimit  int32
+}
+
+type ListWebhookDeliveriesRow struct {
+	WebhookDelivery WebhookDelivery
+	EventType       string
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]ListWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, listWebhookDeliveries,
+		arg.WebhookID,
+		arg.Status,
+		arg.BeforeID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWebhookDeliveriesRow
+	for rows.Next() {
+		var i ListWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.WebhookDelivery.ID,
+			&i.WebhookDelivery.WebhookID,
+			&i.WebhookDelivery.EventID,
+			&i.WebhookDelivery.Status,
+			&i.WebhookDelivery.Attempts,
+			&i.WebhookDelivery.LastStatusCode,
+			&i.WebhookDelivery.LastError,
+			&i.WebhookDelivery.NextAttemptAt,
+			&i.WebhookDelivery.CreatedAt,
+			&i.WebhookDelivery.DeliveredAt,
+			&i.EventType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooks = `-- name: ListWebhooks :many
+SELECT id, url, event_types, secret, created_at FROM webhooks
+ORDER BY id
+`
+
+func (q *Queries) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := q.db.Query(ctx, listWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.EventTypes,
+			&i.Secret,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDeliveryDelivered = `-- name: MarkDeliveryDelivered :exec
+UPDATE webhook_deliveries
+  set status = 'delivered',
+  attempts = attempts + 1,
+  last_status_code = $1,
+  last_error = NULL,
+  delivered_at = now()
+WHERE id = $2 AND status = 'pending'
+`
+
+type MarkDeliveryDeliveredParams struct {
+	StatusCode pgtype.Int4
+	ID         int64
+}
+
+func (q *Queries) MarkDeliveryDelivered(ctx context.Context, arg MarkDeliveryDeliveredParams) error {
+	_, err := q.db.Exec(ctx, markDeliveryDelivered, arg.StatusCode, arg.ID)
+	return err
+}
+
+const markDeliveryFailed = `-- name: MarkDeliveryFailed :exec
+UPDATE webhook_deliveries
+  set status = CASE WHEN attempts + 1 >= $1::integer THEN 'dead' ELSE 'pending' END,
+  attempts = attempts + 1,
+  last_status_code = $2,
+  last_error = $3,
+  next_attempt_at = now() + make_interval(secs => $4::float8)
+WHERE id = $5 AND status = 'pending'
+`
+
+type MarkDeliveryFailedParams struct {
+	MaxAttempts       int32
+	StatusCode        pgtype.Int4
+	LastError         pgtype.Text
+	RetryAfterSeconds float64
+	ID                int64
+}
+
+// Moves the delivery to the dead state once it failed max_attempts times.
+func (q *Queries) MarkDeliveryFailed(ctx context.Context, arg MarkDeliveryFailedParams) error {
+	_, err := q.db.Exec(ctx, markDeliveryFailed,
+		arg.MaxAttempts,
+		arg.StatusCode,
+		arg.LastError,
+		arg.RetryAfterSeconds,
+		arg.ID,
+	)
+	return err
+}
+
+const markOutboxFailed = `-- name: MarkOutboxFailed :exec
+UPDATE outbox
+  set attempts = attempts + 1,
+  last_error = $1,
+  next_attempt_at = now() + make_interval(secs => $2::float8)
+WHERE id = $3 AND published_at IS NULL
+`
+
+type MarkOutboxFailedParams struct {
+	LastError         pgtype.Text
+	RetryAfterSeconds float64
+	ID                int64
+}
+
+func (q *Queries) MarkOutboxFailed(ctx context.Context, arg MarkOutboxFailedParams) error {
+	_, err := q.db.Exec(ctx, markOutboxFailed, arg.LastError, arg.RetryAfterSeconds, arg.ID)
+	return err
+}
+
+const markOutboxPublished = `-- name: MarkOutboxPublished :exec
+UPDATE outbox
+  set published_at = now(),
+  attempts = attempts + 1,
+  last_error = NULL
+WHERE id = $1 AND published_at IS NULL
+`
+
+func (q *Queries) MarkOutboxPublished(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markOutboxPublished, id)
+	return err
+}
+
+const notifyOutboxPositions = `-- name: NotifyOutboxPositions :exec
+SELECT pg_notify('user_events', '')
+`
+
+func (q *Queries) NotifyOutboxPositions(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, notifyOutboxPositions)
+	return err
+}
+
+const purgeUser = `-- name: PurgeUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) PurgeUser(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const redeliverWebhookDelivery = `-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+  set status = 'pending',
+  attempts = 0,
+  next_attempt_at = now()
+WHERE webhook_id = $1 AND id = $2
+RETURNING id, webhook_id, event_id, status, attempts, last_status_code, last_error, next_attempt_at, created_at, delivered_at
+`
+
+type RedeliverWebhookDeliveryParams struct {
+	WebhookID int64
+	ID        int64
+}
+
+// Gives the delivery a new round of attempts, whatever its state.
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRow(ctx, redeliverWebhookDelivery, arg.WebhookID, arg.ID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.WebhookID,
+		&i.EventID,
+		&i.Status,
+		&i.Attempts,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.NextAttemptAt,
+		&i.CreatedAt,
+		&i.DeliveredAt,
+	)
+	return i, err
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+  set deleted_at = NULL,
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, name, other, created_at, updated_at, version, deleted_at
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRow(ctx, restoreUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Other,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, name, other, created_at, updated_at, version,
+  greatest(
+    similarity(name, $1::text),
+    word_similarity($1::text, name),
+    -- Normalisation 32 scales the rank to rank / (rank + 1), so that it
+    -- is between 0 and 1 like similarities.
+    ts_rank(to_tsvector('simple', name || ' ' || coalesce(other, '')), plainto_tsquery('simple', $1::text), 32)
+  )::real AS score
+FROM users
+WHERE deleted_at IS NULL
+  AND (name % $1::text
+    OR $1::text <% name
+    OR to_tsvector('simple', name || ' ' || coalesce(other, '')) @@ plainto_tsquery('simple', $1::text))
+ORDER BY score DESC, id
+LIMIT $2
+`
+
+type SearchUsersParams struct {
+	Query    string
+	RowLimit int32
+}
+
+type SearchUsersRow struct {
+	ID        int64
+	Name      string
+	Other     pgtype.Text
+	CreatedAt pgtype.Timestamp
+	UpdatedAt pgtype.Timestamp
+	Version   int64
+	Score     float32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUsersRow
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Other,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUsersOther = `-- name: SetUsersOther :execrows
+UPDATE users
+  set other = $1,
+  updated_at = now(),
+  version = version + 1
+WHERE id = ANY($2::bigint[])
+`
+
+type SetUsersOtherParams struct {
+	Other pgtype.Text
+	Ids   []int64
+}
+
+func (q *Queries) SetUsersOther(ctx context.Context, arg SetUsersOtherParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUsersOther, arg.Other, arg.Ids)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const tryLockSequencer = `-- name: TryLockSequencer :one
+SELECT pg_try_advisory_lock(hashtext('outbox_position'))
+`
+
+func (q *Queries) TryLockSequencer(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, tryLockSequencer)
+	var pg_try_advisory_lock bool
+	err := row.Scan(&pg_try_advisory_lock)
+	return pg_try_advisory_lock, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
   set name = $2,
   other = $3,
-  updated_at = now()
-WHERE id = $1
-RETURNING id, name, other, created_at, updated_at
+  updated_at = now(),
+  version = version + 1
+WHERE id = $1 AND deleted_at IS NULL
+  AND ($4::bigint[] IS NULL OR version = ANY($4::bigint[]))
+RETURNING id, name, other, created_at, updated_at, version, deleted_at
 `
 
 type UpdateUserParams struct {
-	ID    int64
-	Name  string
-	Other pgtype.Text
+	ID       int64
+	Name     string
+	Other    pgtype.Text
+	Versions []int64
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, updateUser, arg.ID, arg.Name, arg.Other)
+	row := q.db.QueryRow(ctx, updateUser,
+		arg.ID,
+		arg.Name,
+		arg.Other,
+		arg.Versions,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -126,6 +1046,51 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Other,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
 	)
 	return i, err
 }
+
+const upsertUsers = `-- name: UpsertUsers :many
+INSERT INTO users (name, other, created_at)
+SELECT unnest($1::text[]), unnest($2::text[]), now()
+ON CONFLICT (name) WHERE deleted_at IS NULL DO UPDATE
+  set other = excluded.other,
+  updated_at = now(),
+  version = users.version + 1
+RETURNING id, name, other, created_at, updated_at, version, deleted_at
+`
+
+type UpsertUsersParams struct {
+	Names  []string
+	Others []string
+}
+
+func (q *Queries) UpsertUsers(ctx context.Context, arg UpsertUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, upsertUsers, arg.Names, arg.Others)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Other,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/bmcszk/user-service/tracing"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const unnamedQuery = "unnamed"
+
+var tracer = tracing.Tracer("github.com/bmcszk/user-service/db")
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	name string
+	time time.Time
+	span trace.Span
+}
+
+// queryTracer records latency of each query and a client span, both named
+// after the sqlc query. COPY is named after the table, see CopyFromName.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return startQuery(ctx, QueryName(data.SQL), semconv.DBQueryText(data.SQL))
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	endQuery(ctx, data.Err)
+}
+
+func (queryTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return startQuery(ctx, CopyFromName(data.TableName), semconv.DBCollectionName(data.TableName.Sanitize()))
+}
+
+func (queryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	endQuery(ctx, data.Err)
+}
+
+func startQuery(ctx context.Context, name string, attrs ...attribute.KeyValue) context.Context {
+	ctx, span := tracer.Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(name)),
+		trace.WithAttributes(attrs...),
+	)
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		name: name,
+		time: time.Now(),
+		span: span,
+	})
+}
+
+func endQuery(ctx context.Context, err error) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	metrics.ObserveQuery(start.name, time.Since(start.time), err)
+	if err != nil {
+		tracing.RecordError(start.span, err)
+	}
+	start.span.End()
+}
+
+// CopyFromName names a COPY into table, e.g. "CopyFrom.users", as sqlc
+// copyfrom queries carry no name comment.
+func CopyFromName(table pgx.Identifier) string {
+	return "CopyFrom." + strings.Join(table, ".")
+}
+
+// QueryName extracts the query name from the "-- name: GetUser :one"
+// comment sqlc puts in front of every query.
+func QueryName(sql string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(sql, prefix) {
+		return unnamedQuery
+	}
+	fields := strings.Fields(sql[len(prefix):])
+	if len(fields) == 0 {
+		return unnamedQuery
+	}
+	return fields[0]
+}
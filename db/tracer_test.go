@@ -0,0 +1,49 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name         string
+		givenSQL     string
+		expectedName string
+	}{
+		{
+			name:         "sqlc query",
+			givenSQL:     getUser,
+			expectedName: "GetUser",
+		},
+		{
+			name:         "hand-written query",
+			givenSQL:     listUsers,
+			expectedName: "ListUsers",
+		},
+		{
+			name:         "plain query",
+			givenSQL:     "SELECT 1",
+			expectedName: unnamedQuery,
+		},
+		{
+			name:         "empty name",
+			givenSQL:     "-- name: ",
+			expectedName: unnamedQuery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryName(tt.givenSQL); got != tt.expectedName {
+				t.Errorf("QueryName() = %v, want %v", got, tt.expectedName)
+			}
+		})
+	}
+}
+
+func TestCopyFromName(t *testing.T) {
+	if got := CopyFromName(pgx.Identifier{"users"}); got != "CopyFrom.users" {
+		t.Errorf("CopyFromName() = %v, want CopyFrom.users", got)
+	}
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type beginner interface {
+	Begin(context.Context) (pgx.Tx, error)
+}
+
+// inTx runs fn in a transaction committed when fn succeeds. Inside a
+// transaction it runs in a savepoint.
+func (q *Queries) inTx(ctx context.Context, fn func(*Queries) error) error {
+	b, ok := q.db.(beginner)
+	if !ok {
+		return errors.New("transactions not supported")
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	if err := fn(q.WithTx(tx)); err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
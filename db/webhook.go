@@ -0,0 +1,9 @@
+package db
+
+// States of a webhook delivery. A pending delivery is attempted until it
+// is delivered or has failed the maximum attempts, when it is dead.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
@@ -3,6 +3,9 @@ package e2e
 import (
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
 )
 
 func TestPost(t *testing.T) {
@@ -19,6 +22,59 @@ func TestPost(t *testing.T) {
 		userIsStoredInDB()
 }
 
+func TestPost_WritesOutboxEvent(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData()
+
+	when.postRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		userIsReturned().and().
+		outboxHas(db.EventUserCreated)
+}
+
+func TestPost_DeliversToWebhook(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().webhookRegistered(db.EventUserCreated)
+
+	when.postRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		userIsReturned().and().
+		webhookHasDelivery(db.EventUserCreated)
+}
+
+func TestPost_StreamsEvent(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData()
+
+	when.postRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		userIsReturned().and().
+		eventStreamResumesWith(db.EventUserCreated)
+}
+
+func TestPost_StreamsEventsInCommitOrder(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().userCreatedInOpenTransaction()
+
+	when.postRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		userIsReturned().and().
+		openTransactionCommitted().and().
+		eventStreamResumesAfterReturnedUserWith(db.EventUserCreated)
+}
+
 func TestPost_Duplicate(t *testing.T) {
 	given, when, then := NewBlocks(t)
 
@@ -43,6 +99,90 @@ func TestPost_Invalid(t *testing.T) {
 	// TODO check error response
 }
 
+func TestBatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData()
+
+	when.batchRequest("application/json", false).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		batchStatusesAre(http.StatusCreated, http.StatusCreated)
+}
+
+func TestBatch_NDJSON(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData()
+
+	when.batchRequest("application/x-ndjson", true).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusCreated).and().
+		batchStatusesAre(http.StatusCreated, http.StatusCreated)
+}
+
+func TestBatch_AtomicTakenName(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.batchRequest("application/json", true).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusMultiStatus).and().
+		batchStatusesAre(http.StatusConflict, http.StatusFailedDependency)
+}
+
+func TestBulkUpdate(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.bulkRequest("bulkUpdate", map[string]any{"other": nil}).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		onlyGivenUserIsChanged(false)
+}
+
+func TestBulkDelete_DryRun(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.bulkRequest("bulkDelete", map[string]any{"dry_run": true}).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		onlyGivenUserIsChanged(true)
+}
+
+func TestBulkDelete_WritesOutboxEvents(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().otherUsersStoredInDB(2)
+
+	when.bulkRequest("bulkDelete", map[string]any{}).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		outboxOfEachUserHas(db.EventUserDeleted)
+}
+
+func TestBulkDelete_RecordsHistory(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.bulkRequest("bulkDelete", map[string]any{}).withActor("e2e-admin").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		historyHas("delete", "e2e-admin")
+}
+
 func TestGet(t *testing.T) {
 	given, when, then := NewBlocks(t)
 
@@ -84,6 +224,48 @@ func TestPut(t *testing.T) {
 
 // TODO test PUT invalid, not found
 
+func TestPut_IfMatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().and().
+		userIsChanged()
+
+	when.putRequest().withIfMatch(`"1"`).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		etagIs(`"2"`)
+
+	when.putRequest().withIfMatch(`"1"`).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusPreconditionFailed)
+}
+
+func TestPatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.patchRequest("application/merge-patch+json", `{"other": null}`).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		userIsReturned().and().
+		returnedUserHasNoOther()
+}
+
+func TestPatch_UnsupportedMediaType(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.patchRequest("application/json", `{"other": null}`).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusUnsupportedMediaType)
+}
+
 func TestDelete(t *testing.T) {
 	given, when, then := NewBlocks(t)
 
@@ -96,6 +278,100 @@ func TestDelete(t *testing.T) {
 		statusCodeIs(http.StatusNoContent)
 }
 
+func TestDelete_HidesUser(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().alreadyDeletedInDB()
+
+	when.getRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusNotFound)
+}
+
+func TestDelete_RecordsHistory(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.deleteRequest().withActor("e2e-admin").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusNoContent).and().
+		historyHas("delete", "e2e-admin")
+}
+
+func TestGet_AsOf(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().alreadyRenamedInDB()
+
+	when.getAsOfRequest(given.storedAt).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		userIsReturned().and().
+		returnedUserHasGivenName()
+}
+
+func TestGet_AsOfBeforeCreated(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.getAsOfRequest(given.storedAt.Add(-time.Second)).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusNotFound)
+}
+
+func TestRestore(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().alreadyDeletedInDB()
+
+	when.restoreRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		userIsReturned().and().
+		returnedUserIsValid()
+}
+
+func TestRestore_RecordsHistory(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().alreadyDeletedInDB()
+
+	when.restoreRequest().withActor("e2e-admin").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		historyHas("restore", "e2e-admin")
+}
+
+func TestPurge(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().alreadyDeletedInDB()
+
+	when.purgeRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusNoContent)
+}
+
+func TestPurge_NotDeleted(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.purgeRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusConflict)
+}
+
 func TestList(t *testing.T) {
 	given, when, then := NewBlocks(t)
 
@@ -110,5 +386,127 @@ func TestList(t *testing.T) {
 		usersAreReturned().and().
 		returnedUsersAreValid()
 	// TODO check every user returned
-	// TODO check pagination
+}
+
+func TestList_Cursor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().and().
+		userIsChanged().alreadyStoredInDB().and().
+		userIsChanged().alreadyStoredInDB()
+
+	when.listRequestWithLimit(2).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		linkHeaderIsReturned().and().
+		usersAreReturned().and().
+		nextCursorIsReturned().and().
+		totalIsReturned()
+
+	when.nextPageRequest().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		usersAreReturned().and().
+		returnedUsersAreValid().and().
+		pagesDoNotOverlap()
+}
+
+func TestList_Filter(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.listRequestWithNameFilter().sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		usersAreReturned().and().
+		onlyGivenUserIsReturned()
+}
+
+func TestList_Sort(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB().and().
+		userIsChanged().alreadyStoredInDB()
+
+	when.listRequestWithSort("-id").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		usersAreReturned().and().
+		returnedUsersAreValid().and().
+		usersAreSortedByIDDesc()
+}
+
+func TestSearch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.searchRequest(given.givenUser.Name[:8]).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		searchResultsContainGivenUser()
+}
+
+func TestImport_Update(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.importRequest("update").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		importReportIs(1, 1, 0).and().
+		givenUserOtherInDBIs("imported")
+}
+
+func TestImport_InvalidRows(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.importRequest("update", ",no name").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusUnprocessableEntity).and().
+		importReportIs(1, 1, 1).and().
+		givenUserOtherInDBIs(given.givenUser.Other)
+}
+
+func TestExport_CSV(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData().alreadyStoredInDB()
+
+	when.exportRequest("text/csv").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusOK).and().
+		onlyGivenUserIsExportedAsCSV()
+}
+
+func TestExport_NotAcceptable(t *testing.T) {
+	given, when, then := NewBlocks(t)
+
+	given.aValidUserData()
+
+	when.exportRequest("application/xml").sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusNotAcceptable)
+}
+
+func TestList_InvalidLimit(t *testing.T) {
+	_, when, then := NewBlocks(t)
+
+	when.listRequestWithLimit(-1).sending()
+
+	then.noError().and().
+		statusCodeIs(http.StatusBadRequest)
 }
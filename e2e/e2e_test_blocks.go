@@ -1,16 +1,23 @@
 package e2e
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bmcszk/user-service/api"
 	"github.com/bmcszk/user-service/db"
 	"github.com/bmcszk/user-service/logic"
 	"github.com/jackc/pgx/v5"
@@ -25,13 +32,23 @@ type Block struct {
 	serviceUri string
 	queries    *db.Queries
 
-	givenID   int64
-	givenUser logic.User
-	request   *http.Request
+	givenID    int64
+	otherIDs   []int64
+	webhookID  int64
+	openTx     pgx.Tx
+	openUserID int64
+	givenUser  logic.User
+	storedAt   time.Time
+	request    *http.Request
 
 	response      *http.Response
 	returnedUser  *logic.User
 	returnedUsers *logic.UsersResponse
+	searchResults *logic.SearchResponse
+	batchResults  *api.BatchResponse
+	bulkResult    *logic.BulkResult
+	importReport  *logic.ImportReport
+	previousUsers *logic.UsersResponse
 	returnErr     error
 }
 
@@ -95,6 +112,39 @@ func (b *Block) aInvalidUserData() *Block {
 	return b
 }
 
+// webhookRegistered subscribes an unreachable url on a documentation
+// address, which is public but not routed, to eventType, so its deliveries
+// stay pending, and deletes the webhook after the test.
+func (b *Block) webhookRegistered(eventType string) *Block {
+	requestBody, err := json.Marshal(logic.Webhook{
+		URL:        "http://192.0.2.1:9/hooks",
+		EventTypes: []string{eventType},
+		Secret:     randomString(20),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	response, err := b.client.Post(fmt.Sprintf("%s/webhooks", b.serviceUri), "application/json", bytes.NewReader(requestBody))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		b.Fatalf("webhook status code not expected: %v", response.StatusCode)
+	}
+	var webhook logic.Webhook
+	if err := json.NewDecoder(response.Body).Decode(&webhook); err != nil {
+		b.Fatal(err)
+	}
+	b.webhookID = webhook.ID
+	b.Cleanup(func() {
+		if _, err := b.queries.DeleteWebhook(b.ctx, webhook.ID); err != nil {
+			b.Error(err)
+		}
+	})
+	return b
+}
+
 func (b *Block) postRequest() *Block {
 	requestBody, err := json.Marshal(b.givenUser)
 	if err != nil {
@@ -107,6 +157,73 @@ func (b *Block) postRequest() *Block {
 	return b
 }
 
+// batchRequest creates the given user and another random user, encoded as
+// a JSON array or NDJSON.
+func (b *Block) batchRequest(contentType string, atomic bool) *Block {
+	users := []logic.User{b.givenUser, {Name: randomString(10), Other: "e2e test user"}}
+	var requestBody bytes.Buffer
+	if contentType == "application/x-ndjson" {
+		enc := json.NewEncoder(&requestBody)
+		for _, user := range users {
+			if err := enc.Encode(user); err != nil {
+				b.Fatal(err)
+			}
+		}
+	} else if err := json.NewEncoder(&requestBody).Encode(users); err != nil {
+		b.Fatal(err)
+	}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPost, fmt.Sprintf("%s/users:batch?atomic=%t", b.serviceUri, atomic), &requestBody)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.request.Header.Set("Content-Type", contentType)
+	return b
+}
+
+// bulkRequest sends a bulk change of the given and other users to method,
+// bulkUpdate or bulkDelete. The body is completed with their ids.
+func (b *Block) bulkRequest(method string, body map[string]any) *Block {
+	body["ids"] = append([]int64{b.givenID}, b.otherIDs...)
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPost, fmt.Sprintf("%s/users:%s", b.serviceUri, method), bytes.NewReader(requestBody))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+// importRequest imports the given user and a new one from CSV with the
+// name and other in the login and notes columns, and rows appended.
+func (b *Block) importRequest(onConflict string, rows ...string) *Block {
+	content := fmt.Sprintf("login,notes\n%s,imported\n%s,imported\n", b.givenUser.Name, randomString(10))
+	for _, row := range rows {
+		content += row + "\n"
+	}
+	query := url.Values{"mapping": {"name:login,other:notes"}, "on_conflict": {onConflict}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPost, fmt.Sprintf("%s/users:import?%s", b.serviceUri, query.Encode()), strings.NewReader(content))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.request.Header.Set("Content-Type", "text/csv")
+	return b
+}
+
+func (b *Block) exportRequest(accept string) *Block {
+	query := url.Values{"name": {b.givenUser.Name}, "columns": {"id,name"}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users/export?%s", b.serviceUri, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.request.Header.Set("Accept", accept)
+	return b
+}
+
 func (b *Block) getRequest() *Block {
 	var err error
 	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users/%v", b.serviceUri, b.givenID), nil)
@@ -116,6 +233,16 @@ func (b *Block) getRequest() *Block {
 	return b
 }
 
+func (b *Block) getAsOfRequest(asOf time.Time) *Block {
+	query := url.Values{"as_of": {asOf.Format(time.RFC3339Nano)}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users/%v?%s", b.serviceUri, b.givenID, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
 func (b *Block) putRequest() *Block {
 	requestBody, err := json.Marshal(b.givenUser)
 	if err != nil {
@@ -128,6 +255,26 @@ func (b *Block) putRequest() *Block {
 	return b
 }
 
+func (b *Block) patchRequest(contentType, patch string) *Block {
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPatch, fmt.Sprintf("%s/users/%d", b.serviceUri, b.givenID), strings.NewReader(patch))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.request.Header.Set("Content-Type", contentType)
+	return b
+}
+
+func (b *Block) withIfMatch(etag string) *Block {
+	b.request.Header.Set("If-Match", etag)
+	return b
+}
+
+func (b *Block) withActor(actor string) *Block {
+	b.request.Header.Set("X-Actor", actor)
+	return b
+}
+
 func (b *Block) deleteRequest() *Block {
 	var err error
 	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodDelete, fmt.Sprintf("%s/users/%v", b.serviceUri, b.givenID), nil)
@@ -137,6 +284,24 @@ func (b *Block) deleteRequest() *Block {
 	return b
 }
 
+func (b *Block) restoreRequest() *Block {
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPost, fmt.Sprintf("%s/users/%v/restore", b.serviceUri, b.givenID), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) purgeRequest() *Block {
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodPost, fmt.Sprintf("%s/users/%v/purge", b.serviceUri, b.givenID), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
 func (b *Block) listRequest() *Block {
 	var err error
 	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users", b.serviceUri), nil)
@@ -146,6 +311,58 @@ func (b *Block) listRequest() *Block {
 	return b
 }
 
+func (b *Block) listRequestWithLimit(limit int) *Block {
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users?limit=%d", b.serviceUri, limit), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) listRequestWithNameFilter() *Block {
+	query := url.Values{"name": {b.givenUser.Name}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users?%s", b.serviceUri, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) listRequestWithSort(sort string) *Block {
+	query := url.Values{"sort": {sort}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users?%s", b.serviceUri, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) searchRequest(q string) *Block {
+	query := url.Values{"q": {q}}
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users/search?%s", b.serviceUri, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) nextPageRequest() *Block {
+	b.previousUsers = b.returnedUsers
+	query := b.request.URL.Query()
+	query.Set("limit", strconv.Itoa(len(b.previousUsers.Users)))
+	query.Set("cursor", b.previousUsers.NextCursor)
+	var err error
+	b.request, err = http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users?%s", b.serviceUri, query.Encode()), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
 func (b *Block) sending() *Block {
 	b.response, b.returnErr = b.client.Do(b.request)
 	return b
@@ -165,6 +382,13 @@ func (b *Block) statusCodeIs(code int) *Block {
 	return b
 }
 
+func (b *Block) etagIs(etag string) *Block {
+	if got := b.response.Header.Get("ETag"); got != etag {
+		b.Fatalf("etag not expected: %v", got)
+	}
+	return b
+}
+
 func (b *Block) userIsReturned() *Block {
 	err := json.NewDecoder(b.response.Body).Decode(&b.returnedUser)
 	if err != nil {
@@ -174,6 +398,296 @@ func (b *Block) userIsReturned() *Block {
 	return b
 }
 
+func (b *Block) onlyGivenUserIsChanged(dryRun bool) *Block {
+	err := json.NewDecoder(b.response.Body).Decode(&b.bulkResult)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer b.response.Body.Close()
+	if b.bulkResult.Count != 1 || b.bulkResult.IDs[0] != b.givenID || b.bulkResult.DryRun != dryRun || b.bulkResult.WouldExceedLimit {
+		b.Fatalf("bulk result not expected: %+v", b.bulkResult)
+	}
+	return b
+}
+
+func (b *Block) onlyGivenUserIsExportedAsCSV() *Block {
+	defer b.response.Body.Close()
+	body, err := io.ReadAll(b.response.Body)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if expected := fmt.Sprintf("id,name\n%d,%s\n", b.givenID, b.givenUser.Name); string(body) != expected {
+		b.Fatalf("export not expected: %q", body)
+	}
+	return b
+}
+
+func (b *Block) importReportIs(created, updated, errors int) *Block {
+	defer b.response.Body.Close()
+	if err := json.NewDecoder(b.response.Body).Decode(&b.importReport); err != nil {
+		b.Fatal(err)
+	}
+	if b.importReport.Created != created || b.importReport.Updated != updated || len(b.importReport.Errors) != errors {
+		b.Fatalf("import report not expected: %+v", b.importReport)
+	}
+	return b
+}
+
+func (b *Block) givenUserOtherInDBIs(other string) *Block {
+	dbUser, err := b.queries.GetUser(b.ctx, db.GetUserParams{ID: b.givenID})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if dbUser.Other.String != other {
+		b.Fatalf("other in db not expected: %q", dbUser.Other.String)
+	}
+	return b
+}
+
+// historyHas fetches the history of the given user and checks its newest
+// entry.
+func (b *Block) historyHas(action, actor string) *Block {
+	request, err := http.NewRequestWithContext(b.ctx, http.MethodGet, fmt.Sprintf("%s/users/%v/history", b.serviceUri, b.givenID), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	response, err := b.client.Do(request)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		b.Fatalf("history status code not expected: %v", response.StatusCode)
+	}
+	var history logic.AuditResponse
+	if err := json.NewDecoder(response.Body).Decode(&history); err != nil {
+		b.Fatal(err)
+	}
+	if history.Count == 0 {
+		b.Fatal("history is empty")
+	}
+	entry := history.Entries[0]
+	if entry.Action != action || entry.Actor != actor || entry.Before == nil || entry.After == nil {
+		b.Fatalf("history entry not expected: %+v", entry)
+	}
+	return b
+}
+
+// outboxHas checks the outbox events of the returned user.
+func (b *Block) outboxHas(eventTypes ...string) *Block {
+	b.userOutboxHas(b.returnedUser.ID, eventTypes)
+	return b
+}
+
+// outboxOfEachUserHas checks the outbox events of the given and other
+// users.
+func (b *Block) outboxOfEachUserHas(eventTypes ...string) *Block {
+	for _, id := range append([]int64{b.givenID}, b.otherIDs...) {
+		b.userOutboxHas(id, eventTypes)
+	}
+	return b
+}
+
+func (b *Block) userOutboxHas(id int64, eventTypes []string) {
+	events, err := b.queries.ListUserOutboxEvents(b.ctx, id)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(events) != len(eventTypes) {
+		b.Fatalf("outbox events of user %d not expected: %d", id, len(events))
+	}
+	for i, event := range events {
+		if event.EventType != eventTypes[i] || event.Payload == nil {
+			b.Fatalf("outbox event not expected: %+v", event)
+		}
+	}
+}
+
+// webhookHasDelivery checks that the webhook has a delivery of the
+// eventType event of the returned user.
+func (b *Block) webhookHasDelivery(eventType string) *Block {
+	events, err := b.queries.ListUserOutboxEvents(b.ctx, b.returnedUser.ID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(events) == 0 {
+		b.Fatal("outbox event not written")
+	}
+	response, err := b.client.Get(fmt.Sprintf("%s/webhooks/%v/deliveries?limit=100", b.serviceUri, b.webhookID))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		b.Fatalf("deliveries status code not expected: %v", response.StatusCode)
+	}
+	var deliveries logic.DeliveriesResponse
+	if err := json.NewDecoder(response.Body).Decode(&deliveries); err != nil {
+		b.Fatal(err)
+	}
+	for _, delivery := range deliveries.Deliveries {
+		if delivery.EventID == events[0].ID && delivery.EventType == eventType && delivery.Status != "delivered" {
+			return b
+		}
+	}
+	b.Fatalf("delivery not found: %+v", deliveries)
+	return b
+}
+
+// eventStreamResumesWith reads the event stream resumed before the first
+// outbox event of the returned user until that event is received.
+func (b *Block) eventStreamResumesWith(eventType string) *Block {
+	position := b.eventPosition(b.returnedUser.ID)
+	b.streamedEvent(position-1, func(id, event string, data []byte) bool {
+		if id != strconv.FormatInt(position, 10) {
+			return false
+		}
+		if event != eventType {
+			b.Fatalf("event not expected: %q", event)
+		}
+		return true
+	})
+	return b
+}
+
+// userCreatedInOpenTransaction creates a user in a transaction left open,
+// so that its outbox event has a lower id than events committed before it,
+// and rolls it back after the test unless committed.
+func (b *Block) userCreatedInOpenTransaction() *Block {
+	conn, err := pgx.Connect(b.ctx, os.Getenv("POSTGRES_URL"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		conn.Close(context.Background())
+	})
+	tx, err := conn.Begin(b.ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = tx.Rollback(context.Background())
+	})
+	user, err := db.New(tx).CreateUserAudited(b.ctx, db.CreateUserParams{
+		Name:  randomString(10),
+		Other: pgtype.Text{String: "e2e test user", Valid: true},
+	}, db.Audit{Actor: "e2e"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.openTx, b.openUserID = tx, user.ID
+	return b
+}
+
+// openTransactionCommitted commits the open transaction after the event of
+// the returned user is streamed.
+func (b *Block) openTransactionCommitted() *Block {
+	b.eventPosition(b.returnedUser.ID)
+	if err := b.openTx.Commit(b.ctx); err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+// eventStreamResumesAfterReturnedUserWith reads the event stream resumed
+// after the event of the returned user until the event of the user created
+// in the open transaction is received.
+func (b *Block) eventStreamResumesAfterReturnedUserWith(eventType string) *Block {
+	position := b.eventPosition(b.returnedUser.ID)
+	b.streamedEvent(position, func(id, event string, data []byte) bool {
+		var received struct {
+			UserID int64 `json:"user_id"`
+		}
+		if err := json.Unmarshal(data, &received); err != nil {
+			b.Fatal(err)
+		}
+		if received.UserID != b.openUserID {
+			return false
+		}
+		if event != eventType {
+			b.Fatalf("event not expected: %q", event)
+		}
+		return true
+	})
+	return b
+}
+
+// eventPosition waits until the first outbox event of a user is streamed
+// and returns its position.
+func (b *Block) eventPosition(userID int64) int64 {
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		events, err := b.queries.ListUserOutboxEvents(b.ctx, userID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(events) > 0 && events[0].Position.Valid {
+			return events[0].Position.Int64
+		}
+	}
+	b.Fatalf("event of user %d not positioned", userID)
+	return 0
+}
+
+// streamedEvent reads the event stream resumed after position until found
+// returns true for an event.
+func (b *Block) streamedEvent(position int64, found func(id, event string, data []byte) bool) {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/users/events", b.serviceUri), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	request.Header.Set("Last-Event-ID", strconv.FormatInt(position, 10))
+	response, err := b.client.Do(request)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		b.Fatalf("events status code not expected: %v", response.StatusCode)
+	}
+	scanner := bufio.NewScanner(response.Body)
+	var id, event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if field, value, ok := strings.Cut(line, ": "); ok {
+				switch field {
+				case "id":
+					id = value
+				case "event":
+					event = value
+				case "data":
+					data = value
+				}
+			}
+			continue
+		}
+		if data != "" && found(id, event, []byte(data)) {
+			return
+		}
+		id, event, data = "", "", ""
+	}
+	b.Fatalf("event not received: %v", scanner.Err())
+}
+
+func (b *Block) batchStatusesAre(statuses ...int) *Block {
+	err := json.NewDecoder(b.response.Body).Decode(&b.batchResults)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer b.response.Body.Close()
+	if len(b.batchResults.Results) != len(statuses) {
+		b.Fatalf("batch results not expected: %v", b.batchResults.Results)
+	}
+	for i, status := range statuses {
+		if got := b.batchResults.Results[i].Status; got != status {
+			b.Fatalf("status of user %d not expected: %v", i, got)
+		}
+	}
+	return b
+}
+
 func (b *Block) returnedUserIsValid() *Block {
 	if b.returnedUser == nil {
 		b.Fatal("user not returned")
@@ -184,6 +698,20 @@ func (b *Block) returnedUserIsValid() *Block {
 	return b
 }
 
+func (b *Block) returnedUserHasGivenName() *Block {
+	if b.returnedUser.Name != b.givenUser.Name {
+		b.Fatalf("returned user name not expected: %v", b.returnedUser.Name)
+	}
+	return b
+}
+
+func (b *Block) returnedUserHasNoOther() *Block {
+	if b.returnedUser.Name != b.givenUser.Name || b.returnedUser.Other != "" {
+		b.Fatalf("user not expected: %+v", b.returnedUser)
+	}
+	return b
+}
+
 func (b *Block) userIsValid(user *logic.User) *Block {
 	if user == nil {
 		b.Fatal("user not returned")
@@ -216,6 +744,75 @@ func (b *Block) returnedUsersAreValid() *Block {
 	return b
 }
 
+func (b *Block) nextCursorIsReturned() *Block {
+	if b.returnedUsers.NextCursor == "" {
+		b.Fatal("next cursor not returned")
+	}
+	return b
+}
+
+func (b *Block) totalIsReturned() *Block {
+	if b.returnedUsers.Total == nil || *b.returnedUsers.Total < int64(b.returnedUsers.Count) {
+		b.Fatalf("total not expected: %v", b.returnedUsers.Total)
+	}
+	if !b.returnedUsers.HasMore {
+		b.Fatal("has more not returned")
+	}
+	return b
+}
+
+func (b *Block) linkHeaderIsReturned() *Block {
+	if b.response.Header.Get("Link") == "" {
+		b.Fatal("link header not returned")
+	}
+	return b
+}
+
+func (b *Block) onlyGivenUserIsReturned() *Block {
+	if len(b.returnedUsers.Users) != 1 || b.returnedUsers.Users[0].ID != b.givenID {
+		b.Fatalf("users not expected: %v", b.returnedUsers.Users)
+	}
+	if b.returnedUsers.Total == nil || *b.returnedUsers.Total != 1 {
+		b.Fatalf("total not expected: %v", b.returnedUsers.Total)
+	}
+	return b
+}
+
+func (b *Block) usersAreSortedByIDDesc() *Block {
+	for i := 1; i < len(b.returnedUsers.Users); i++ {
+		if b.returnedUsers.Users[i-1].ID < b.returnedUsers.Users[i].ID {
+			b.Fatal("users not sorted by id descending")
+		}
+	}
+	return b
+}
+
+func (b *Block) searchResultsContainGivenUser() *Block {
+	err := json.NewDecoder(b.response.Body).Decode(&b.searchResults)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer b.response.Body.Close()
+	for _, user := range b.searchResults.Users {
+		if user.ID == b.givenID {
+			return b
+		}
+	}
+	b.Fatalf("user %d not found: %v", b.givenID, b.searchResults.Users)
+	return b
+}
+
+func (b *Block) pagesDoNotOverlap() *Block {
+	for _, previous := range b.previousUsers.Users {
+		for _, user := range b.returnedUsers.Users {
+			if previous.ID == user.ID {
+				b.Fatalf("user %d returned on two pages", user.ID)
+			}
+		}
+	}
+	return b
+}
+
 func (b *Block) alreadyStoredInDB() *Block {
 	dbUser, err := b.queries.CreateUser(b.ctx, db.CreateUserParams{
 		Name:  b.givenUser.Name,
@@ -225,11 +822,47 @@ func (b *Block) alreadyStoredInDB() *Block {
 		b.Fatal(err)
 	}
 	b.givenID = dbUser.ID
+	b.storedAt = dbUser.CreatedAt.Time
+	return b
+}
+
+// otherUsersStoredInDB stores n more users, bypassing the service like
+// alreadyStoredInDB.
+func (b *Block) otherUsersStoredInDB(n int) *Block {
+	for range n {
+		dbUser, err := b.queries.CreateUser(b.ctx, db.CreateUserParams{
+			Name:  randomString(10),
+			Other: pgtype.Text{String: b.givenUser.Other, Valid: true},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.otherIDs = append(b.otherIDs, dbUser.ID)
+	}
+	return b
+}
+
+func (b *Block) alreadyRenamedInDB() *Block {
+	_, err := b.queries.UpdateUser(b.ctx, db.UpdateUserParams{
+		ID:    b.givenID,
+		Name:  randomString(10),
+		Other: pgtype.Text{String: b.givenUser.Other, Valid: true},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return b
+}
+
+func (b *Block) alreadyDeletedInDB() *Block {
+	if _, err := b.queries.DeleteUser(b.ctx, db.DeleteUserParams{ID: b.givenID}); err != nil {
+		b.Fatal(err)
+	}
 	return b
 }
 
 func (b *Block) userIsStoredInDB() *Block {
-	dbUser, err := b.queries.GetUser(b.ctx, b.returnedUser.ID)
+	dbUser, err := b.queries.GetUser(b.ctx, db.GetUserParams{ID: b.returnedUser.ID})
 	if err != nil {
 		b.Fatal(err)
 	}
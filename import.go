@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/bmcszk/user-service/config"
+	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/logic"
+)
+
+var importExtensions = map[string]string{
+	".csv":    logic.ImportCSV,
+	".ndjson": logic.ImportNDJSON,
+	".jsonl":  logic.ImportNDJSON,
+}
+
+type importArgs struct {
+	file   string
+	params logic.ImportParams
+}
+
+// parseImportArgs reads the flags of the import command and the file to
+// import, "-" for stdin. The format defaults to the one of the file
+// extension.
+func parseImportArgs(args []string, stderr io.Writer) (importArgs, error) {
+	fs := flag.NewFlagSet("user-service import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: user-service import [flags] FILE")
+		fs.PrintDefaults()
+	}
+	var a importArgs
+	fs.StringVar(&a.params.Format, "format", "", "file format: csv, ndjson (default from file extension)")
+	mapping := fs.String("mapping", "", "CSV header columns of user fields, e.g. name:login,other:notes")
+	fs.StringVar(&a.params.OnConflict, "on-conflict", logic.OnConflictSkip, "rows with names of existing users: skip, update")
+	fs.BoolVar(&a.params.DryRun, "dry-run", false, "report what the import would do without changing users")
+	if err := fs.Parse(args); err != nil {
+		return a, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return a, errors.New("import needs exactly one file")
+	}
+	a.file = fs.Arg(0)
+	if a.params.Format == "" {
+		a.params.Format = importExtensions[filepath.Ext(a.file)]
+	}
+	var err error
+	a.params.Mapping, err = logic.ParseImportMapping(*mapping)
+	return a, err
+}
+
+// runImport imports users from a file with the database configured like
+// for the server, by env vars or CONFIG_FILE, and prints the report as
+// JSON. It returns the exit code, 1 when rows failed.
+func runImport(ctx context.Context, args []string) int {
+	a, err := parseImportArgs(args, os.Stderr)
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+	cfg, err := config.Load(nil, os.Getenv)
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+	postgresUrl, err := cfg.DB.ConnString()
+	if err != nil {
+		slog.Error(err.Error())
+		return 2
+	}
+	in := os.Stdin
+	if a.file != "-" {
+		if in, err = os.Open(a.file); err != nil {
+			slog.Error(err.Error())
+			return 2
+		}
+		defer in.Close()
+	}
+	pool, err := db.InitDB(ctx, postgresUrl, db.PoolConfig{
+		MaxConns:          cfg.DB.MaxConns,
+		MinConns:          cfg.DB.MinConns,
+		MaxConnIdleTime:   cfg.DB.MaxConnIdleTime,
+		MaxConnLifetime:   cfg.DB.MaxConnLifetime,
+		HealthCheckPeriod: cfg.DB.HealthCheckPeriod,
+	})
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	defer pool.Close()
+	service := logic.NewService(db.New(pool))
+	report, err := service.ImportUsers(ctx, in, a.params)
+	if err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		slog.Error(err.Error())
+		return 1
+	}
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
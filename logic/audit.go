@@ -0,0 +1,160 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AnonymousActor is recorded for changes made without an actor.
+const AnonymousActor = "anonymous"
+
+var auditActions = []string{db.AuditCreate, db.AuditUpdate, db.AuditDelete, db.AuditRestore, db.AuditPurge}
+
+// AuditEntry records a change of a user. Before and After are the stored
+// user rows, Before is absent on create and After on purge.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type AuditResponse struct {
+	Entries    []*AuditEntry `json:"entries"`
+	Count      int           `json:"count"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// AuditFilter narrows audit entries. Zero fields do not filter. The time
+// range is half-open like in Filter.
+type AuditFilter struct {
+	UserID        int64
+	Actor         string
+	Action        string
+	RequestID     string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// AuditParams selects a page of entries, newest first, by an opaque Cursor
+// taken from next_cursor of a previous page.
+type AuditParams struct {
+	Filter AuditFilter
+	Limit  int32
+	Cursor string
+}
+
+// auditOf tells who makes the change from the request context.
+func auditOf(ctx context.Context) db.Audit {
+	actor := logging.Actor(ctx)
+	if actor == "" {
+		actor = AnonymousActor
+	}
+	return db.Audit{Actor: actor, RequestID: logging.RequestID(ctx)}
+}
+
+func validateAuditParams(params AuditParams) error {
+	if params.Limit < 1 || params.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPagination, MaxLimit)
+	}
+	f := params.Filter
+	if f.Action != "" && !slices.Contains(auditActions, f.Action) {
+		return fmt.Errorf("%w: action must be one of %s", ErrInvalidFilter, strings.Join(auditActions, ", "))
+	}
+	if isEmptyRange(f.CreatedAfter, f.CreatedBefore) {
+		return fmt.Errorf("%w: created_after must be before created_before", ErrInvalidFilter)
+	}
+	return nil
+}
+
+func (f AuditFilter) toDB() db.AuditFilter {
+	return db.AuditFilter{
+		UserID:        f.UserID,
+		Actor:         f.Actor,
+		Action:        f.Action,
+		RequestID:     f.RequestID,
+		CreatedAfter:  toTimestamp(f.CreatedAfter),
+		CreatedBefore: toTimestamp(f.CreatedBefore),
+	}
+}
+
+// ListAudit returns audit entries matching the filter, newest first.
+func (s *Service) ListAudit(ctx context.Context, params AuditParams) (_ *AuditResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListAudit")
+	defer func() { endSpan(span, err) }()
+	if err := validateAuditParams(params); err != nil {
+		return nil, err
+	}
+	query := db.ListAuditParams{
+		Filter: params.Filter.toDB(),
+		Limit:  params.Limit + 1,
+	}
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.BeforeID = c.ID
+	}
+	rows, err := s.userRepo.ListAudit(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	res := &AuditResponse{}
+	if len(rows) > int(params.Limit) {
+		rows = rows[:params.Limit]
+		last := rows[len(rows)-1]
+		res.NextCursor = encodeCursor(cursor{ID: last.ID, CreatedAt: last.CreatedAt.Time})
+	}
+	res.Entries = make([]*AuditEntry, len(rows))
+	for i, row := range rows {
+		res.Entries[i] = fromDBAudit(row)
+	}
+	res.Count = len(rows)
+	return res, nil
+}
+
+// GetUserHistory returns the audit entries of a user, newest first. The
+// history outlives the user, so it fails with ErrUserNotFound only when
+// there is neither.
+func (s *Service) GetUserHistory(ctx context.Context, id int64, params AuditParams) (_ *AuditResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetUserHistory", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	params.Filter = AuditFilter{UserID: id}
+	res, err := s.ListAudit(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if res.Count == 0 && params.Cursor == "" {
+		if _, err := s.GetUserByID(ctx, id, true); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func fromDBAudit(row db.AuditLog) *AuditEntry {
+	return &AuditEntry{
+		ID:        row.ID,
+		UserID:    row.UserID,
+		Action:    row.Action,
+		Actor:     row.Actor,
+		RequestID: row.RequestID.String,
+		Before:    row.Before,
+		After:     row.After,
+		CreatedAt: row.CreatedAt.Time,
+	}
+}
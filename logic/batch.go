@@ -0,0 +1,175 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const MaxBatchSize = 10000
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// ErrBatchAborted fails valid items of an atomic batch that another item
+// failed.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// BatchResult is the outcome of one item of a batch, in request order.
+// Either User or Err is set.
+type BatchResult struct {
+	User *User
+	Err  error
+}
+
+func validateBatchSize(size int) error {
+	if size < 1 || size > MaxBatchSize {
+		return fmt.Errorf("%w: batch must have between 1 and %d users", ErrInvalidBatch, MaxBatchSize)
+	}
+	return nil
+}
+
+// CreateUsers creates users in bulk. Each user is validated like on create
+// and a name repeated in the batch fails with ErrUserAlreadyExists. Without
+// atomic valid users are created and the rest fail on their own. With
+// atomic users are copied in a single transaction, so one failed user
+// aborts all.
+func (s *Service) CreateUsers(ctx context.Context, users []User, atomic bool) (_ []BatchResult, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateUsers", trace.WithAttributes(
+		attribute.Int("batch.size", len(users)),
+		attribute.Bool("batch.atomic", atomic),
+	))
+	defer func() { endSpan(span, err) }()
+	if err := validateBatchSize(len(users)); err != nil {
+		return nil, err
+	}
+	results := make([]BatchResult, len(users))
+	valid := make(map[string]int, len(users))
+	var failed bool
+	for i, user := range users {
+		if err := validateUser(user); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		if _, ok := valid[user.Name]; ok {
+			results[i].Err = fmt.Errorf("%w: name repeated in batch", ErrUserAlreadyExists)
+			failed = true
+			continue
+		}
+		valid[user.Name] = i
+	}
+	if atomic && failed {
+		abort(results)
+		return results, nil
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	if atomic {
+		err = s.copyUsers(ctx, users, valid, results)
+	} else {
+		err = s.createUsers(ctx, users, valid, results)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// createUsers inserts valid users skipping names taken by existing users.
+func (s *Service) createUsers(ctx context.Context, users []User, valid map[string]int, results []BatchResult) error {
+	params := db.CreateUsersParams{
+		Names:  make([]string, 0, len(valid)),
+		Others: make([]string, 0, len(valid)),
+	}
+	for _, i := range inOrder(users, valid) {
+		params.Names = append(params.Names, users[i].Name)
+		params.Others = append(params.Others, users[i].Other)
+	}
+	dbUsers, err := s.userRepo.CreateUsersAudited(ctx, params, auditOf(ctx))
+	if err != nil {
+		return err
+	}
+	setCreated(results, valid, dbUsers)
+	for _, i := range valid {
+		if results[i].User == nil {
+			results[i].Err = ErrUserAlreadyExists
+		}
+	}
+	return nil
+}
+
+// copyUsers inserts all valid users or, when a name is taken, none.
+func (s *Service) copyUsers(ctx context.Context, users []User, valid map[string]int, results []BatchResult) error {
+	params := make([]db.CopyUsersParams, 0, len(valid))
+	for _, i := range inOrder(users, valid) {
+		params = append(params, db.CopyUsersParams{
+			Name:  users[i].Name,
+			Other: pgtype.Text{String: users[i].Other, Valid: true},
+		})
+	}
+	dbUsers, err := s.userRepo.CopyUsersAtomic(ctx, params, auditOf(ctx))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == DuplicateErrorCode {
+		return s.findTakenNames(ctx, valid, results)
+	}
+	if err != nil {
+		return err
+	}
+	setCreated(results, valid, dbUsers)
+	return nil
+}
+
+// findTakenNames tells which users of an aborted atomic batch have names of
+// existing users.
+func (s *Service) findTakenNames(ctx context.Context, valid map[string]int, results []BatchResult) error {
+	names := make([]string, 0, len(valid))
+	for name := range valid {
+		names = append(names, name)
+	}
+	existing, err := s.userRepo.GetUsersByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	for _, dbUser := range existing {
+		results[valid[dbUser.Name]].Err = ErrUserAlreadyExists
+	}
+	abort(results)
+	return nil
+}
+
+// inOrder returns indexes of valid users in request order, so ids are
+// assigned in that order.
+func inOrder(users []User, valid map[string]int) []int {
+	indexes := make([]int, 0, len(valid))
+	for i, user := range users {
+		if j, ok := valid[user.Name]; ok && i == j {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// setCreated matches created users to items by name, unique in the batch.
+func setCreated(results []BatchResult, valid map[string]int, dbUsers []db.User) {
+	for _, dbUser := range dbUsers {
+		if i, ok := valid[dbUser.Name]; ok {
+			results[i].User = FromDBUser(dbUser)
+		}
+	}
+}
+
+// abort fails every item that has not failed yet with ErrBatchAborted.
+func abort(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const DefaultBulkMaxRows = 1000
+
+var ErrInvalidBulk = errors.New("invalid bulk change")
+var ErrTooManyUsers = errors.New("too many users")
+
+// BulkSelector selects the users of a bulk change by IDs or by Filter, not
+// both. Deleted users are never selected.
+type BulkSelector struct {
+	IDs    []int64 `json:"ids,omitempty"`
+	Filter *Filter `json:"filter,omitempty"`
+	// DryRun reports the users that would change without changing them.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BulkUpdate sets Other of the selected users, null clears it.
+type BulkUpdate struct {
+	BulkSelector
+	Other json.RawMessage `json:"other"`
+}
+
+// BulkResult lists the ids of users changed, or that would change in a dry
+// run. A dry run lists at most the bulk max rows users but counts all, and
+// tells whether the change would fail for selecting too many.
+type BulkResult struct {
+	IDs              []int64 `json:"ids"`
+	Count            int     `json:"count"`
+	DryRun           bool    `json:"dry_run"`
+	WouldExceedLimit bool    `json:"would_exceed_limit"`
+}
+
+func (s *Service) bulkParams(sel BulkSelector) (db.BulkParams, error) {
+	params := db.BulkParams{
+		MaxRows: s.bulkMaxRows,
+		DryRun:  sel.DryRun,
+	}
+	if (len(sel.IDs) == 0) == (sel.Filter == nil) {
+		return params, fmt.Errorf("%w: either ids or filter is required", ErrInvalidBulk)
+	}
+	if !sel.DryRun && len(sel.IDs) > int(s.bulkMaxRows) {
+		return params, fmt.Errorf("%w: at most %d ids allowed", ErrTooManyUsers, s.bulkMaxRows)
+	}
+	if sel.Filter != nil {
+		if err := validateFilter(*sel.Filter); err != nil {
+			return params, err
+		}
+		if *sel.Filter == (Filter{}) {
+			return params, fmt.Errorf("%w: filter must not be empty", ErrInvalidBulk)
+		}
+		if sel.Filter.IncludeDeleted {
+			return params, fmt.Errorf("%w: deleted users cannot be changed", ErrInvalidBulk)
+		}
+		params.Filter = sel.Filter.toDB()
+		return params, nil
+	}
+	for _, id := range sel.IDs {
+		if id < 1 {
+			return params, fmt.Errorf("%w: id %d is not valid", ErrInvalidBulk, id)
+		}
+	}
+	params.IDs = sel.IDs
+	return params, nil
+}
+
+func parseBulkOther(raw json.RawMessage) (pgtype.Text, error) {
+	if len(raw) == 0 {
+		return pgtype.Text{}, fmt.Errorf("%w: other is required", ErrInvalidBulk)
+	}
+	var other *string
+	if err := json.Unmarshal(raw, &other); err != nil {
+		return pgtype.Text{}, fmt.Errorf("%w: other must be a string or null", ErrInvalidBulk)
+	}
+	if other == nil {
+		return pgtype.Text{}, nil
+	}
+	return pgtype.Text{String: *other, Valid: true}, nil
+}
+
+// BulkUpdateUsers sets other of the selected users in one transaction. It
+// fails with ErrTooManyUsers, changing nothing, when more users than the
+// bulk max rows are selected, except in a dry run.
+func (s *Service) BulkUpdateUsers(ctx context.Context, update BulkUpdate) (_ *BulkResult, err error) {
+	ctx, span := tracer.Start(ctx, "Service.BulkUpdateUsers", trace.WithAttributes(attribute.Bool("bulk.dry_run", update.DryRun)))
+	defer func() { endSpan(span, err) }()
+	params, err := s.bulkParams(update.BulkSelector)
+	if err != nil {
+		return nil, err
+	}
+	other, err := parseBulkOther(update.Other)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.userRepo.BulkSetUsersOther(ctx, params, other, auditOf(ctx))
+	return s.bulkResult(ctx, ids, params, err)
+}
+
+// BulkDeleteUsers soft deletes the selected users in one transaction, like
+// BulkUpdateUsers.
+func (s *Service) BulkDeleteUsers(ctx context.Context, sel BulkSelector) (_ *BulkResult, err error) {
+	ctx, span := tracer.Start(ctx, "Service.BulkDeleteUsers", trace.WithAttributes(attribute.Bool("bulk.dry_run", sel.DryRun)))
+	defer func() { endSpan(span, err) }()
+	params, err := s.bulkParams(sel)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.userRepo.BulkDeleteUsers(ctx, params, auditOf(ctx))
+	return s.bulkResult(ctx, ids, params, err)
+}
+
+func (s *Service) bulkResult(ctx context.Context, ids []int64, params db.BulkParams, err error) (*BulkResult, error) {
+	if errors.Is(err, db.ErrTooManyRows) {
+		return nil, fmt.Errorf("%w: more than %d users selected", ErrTooManyUsers, params.MaxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &BulkResult{
+		IDs:    ids,
+		Count:  len(ids),
+		DryRun: params.DryRun,
+	}
+	if params.DryRun {
+		count, err := s.userRepo.CountBulkUsers(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		result.Count = int(count)
+		result.WouldExceedLimit = count > int64(params.MaxRows)
+	}
+	return result, nil
+}
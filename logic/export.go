@@ -0,0 +1,77 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+var ErrInvalidExport = errors.New("invalid export")
+
+// ExportColumns are the columns users can be exported with, in the default
+// order.
+var ExportColumns = []string{"id", "name", "other", "created_at", "updated_at", "version", "deleted_at"}
+
+// ExportParams selects users like the list filter. Columns default to
+// ExportColumns.
+type ExportParams struct {
+	Filter  Filter
+	Columns []string
+}
+
+func validateExportParams(params ExportParams) error {
+	if err := validateFilter(params.Filter); err != nil {
+		return err
+	}
+	for i, column := range params.Columns {
+		if !slices.Contains(ExportColumns, column) {
+			return fmt.Errorf("%w: unknown column %q", ErrInvalidExport, column)
+		}
+		if slices.Contains(params.Columns[:i], column) {
+			return fmt.Errorf("%w: column %q repeated", ErrInvalidExport, column)
+		}
+	}
+	return nil
+}
+
+// ExportUsers passes users matching the filter to fn in id order, one at a
+// time, so users are streamed without holding them in memory. An error of
+// fn stops the export and is returned.
+func (s *Service) ExportUsers(ctx context.Context, params ExportParams, fn func(*User) error) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.ExportUsers")
+	defer func() { endSpan(span, err) }()
+	if err := validateExportParams(params); err != nil {
+		return err
+	}
+	return s.userRepo.ExportUsers(ctx, params.Filter.toDB(), func(dbUser db.User) error {
+		return fn(FromDBUser(dbUser))
+	})
+}
+
+// Column returns the value of an export column, nil when not set.
+func (u *User) Column(name string) any {
+	switch name {
+	case "id":
+		return u.ID
+	case "name":
+		return u.Name
+	case "other":
+		return u.Other
+	case "created_at":
+		return u.CreatedAt
+	case "updated_at":
+		if u.UpdatedAt != nil {
+			return *u.UpdatedAt
+		}
+	case "version":
+		return u.Version
+	case "deleted_at":
+		if u.DeletedAt != nil {
+			return *u.DeletedAt
+		}
+	}
+	return nil
+}
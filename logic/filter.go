@@ -0,0 +1,78 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const maxNameFilterLength = 255
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter narrows listed users. Zero fields do not filter, except that soft
+// deleted users are excluded unless IncludeDeleted is set. Time ranges are
+// half-open: after is inclusive, before is exclusive.
+type Filter struct {
+	Name          string     `json:"name,omitempty"`
+	NamePrefix    string     `json:"name_prefix,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter  *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+	// UpdatedSince matches users created or updated since the time.
+	UpdatedSince   *time.Time `json:"updated_since,omitempty"`
+	HasOther       *bool      `json:"has_other,omitempty"`
+	IncludeDeleted bool       `json:"include_deleted,omitempty"`
+	// AsOf lists users as they were at the time. Only lists honour it.
+	AsOf *time.Time `json:"-"`
+}
+
+func validateFilter(f Filter) error {
+	if f.Name != "" && f.NamePrefix != "" {
+		return fmt.Errorf("%w: name and name_prefix cannot be combined", ErrInvalidFilter)
+	}
+	if len(f.Name) > maxNameFilterLength || len(f.NamePrefix) > maxNameFilterLength {
+		return fmt.Errorf("%w: name must be at most %d bytes", ErrInvalidFilter, maxNameFilterLength)
+	}
+	if isEmptyRange(f.CreatedAfter, f.CreatedBefore) {
+		return fmt.Errorf("%w: created_after must be before created_before", ErrInvalidFilter)
+	}
+	if isEmptyRange(f.UpdatedAfter, f.UpdatedBefore) {
+		return fmt.Errorf("%w: updated_after must be before updated_before", ErrInvalidFilter)
+	}
+	return nil
+}
+
+func isEmptyRange(after, before *time.Time) bool {
+	return after != nil && before != nil && !after.Before(*before)
+}
+
+func (f Filter) toDB() db.UserFilter {
+	filter := db.UserFilter{
+		Name:           f.Name,
+		NamePrefix:     f.NamePrefix,
+		CreatedAfter:   toTimestamp(f.CreatedAfter),
+		CreatedBefore:  toTimestamp(f.CreatedBefore),
+		UpdatedAfter:   toTimestamp(f.UpdatedAfter),
+		UpdatedBefore:  toTimestamp(f.UpdatedBefore),
+		UpdatedSince:   toTimestamp(f.UpdatedSince),
+		IncludeDeleted: f.IncludeDeleted,
+		AsOf:           toTimestamp(f.AsOf),
+	}
+	if f.HasOther != nil {
+		filter.HasOther = pgtype.Bool{Bool: *f.HasOther, Valid: true}
+	}
+	return filter
+}
+
+// toTimestamp converts to UTC as timestamps are stored without time zone.
+func toTimestamp(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{}
+	}
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}
+}
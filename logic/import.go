@@ -0,0 +1,322 @@
+package logic
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/bmcszk/user-service/db"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const MaxImportRows = 100000
+
+// maxImportLine is the longest NDJSON line accepted.
+const maxImportLine = 1 << 20
+
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// Conflict policies of an import for names of existing users.
+const (
+	OnConflictSkip   = "skip"
+	OnConflictUpdate = "update"
+)
+
+var ErrInvalidImport = errors.New("invalid import")
+
+// importFields are the user fields a CSV column can be mapped to.
+var importFields = []string{"name", "other"}
+
+// ImportParams describes an import. Mapping maps user fields to CSV header
+// columns, by default each field is read from the column of its name.
+// OnConflict defaults to OnConflictSkip.
+type ImportParams struct {
+	Format     string
+	Mapping    map[string]string
+	OnConflict string
+	DryRun     bool
+}
+
+// ImportLine points at a line of the imported file.
+type ImportLine struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ImportReport tells what an import did or, on a dry run, would do.
+// Conflicts are rows with names of existing users, skipped or updated by
+// the policy. With any Errors nothing is imported.
+type ImportReport struct {
+	Rows      int          `json:"rows"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Skipped   int          `json:"skipped"`
+	Conflicts []ImportLine `json:"conflicts,omitempty"`
+	Errors    []ImportLine `json:"errors,omitempty"`
+	DryRun    bool         `json:"dry_run"`
+}
+
+// importRow is a parsed row with its line number.
+type importRow struct {
+	line int
+	user User
+}
+
+// ParseImportMapping parses a mapping like "name:login,other:notes".
+func ParseImportMapping(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, ":")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("%w: mapping %q must be field:column", ErrInvalidImport, pair)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+func validateImportParams(params *ImportParams) error {
+	if params.Format != ImportCSV && params.Format != ImportNDJSON {
+		return fmt.Errorf("%w: format must be %s or %s", ErrInvalidImport, ImportCSV, ImportNDJSON)
+	}
+	if params.OnConflict == "" {
+		params.OnConflict = OnConflictSkip
+	}
+	if params.OnConflict != OnConflictSkip && params.OnConflict != OnConflictUpdate {
+		return fmt.Errorf("%w: on_conflict must be %s or %s", ErrInvalidImport, OnConflictSkip, OnConflictUpdate)
+	}
+	if len(params.Mapping) > 0 && params.Format != ImportCSV {
+		return fmt.Errorf("%w: mapping applies to %s only", ErrInvalidImport, ImportCSV)
+	}
+	for field := range params.Mapping {
+		if !slices.Contains(importFields, field) {
+			return fmt.Errorf("%w: unknown field %q in mapping", ErrInvalidImport, field)
+		}
+	}
+	return nil
+}
+
+// ImportUsers reads users from CSV with a header row or from NDJSON and
+// validates every row. Rows that fail validation or repeat a name of an
+// earlier row are reported as errors with their line, and any error leaves
+// the users as they were. Rows with names of existing users are skipped or
+// update other of those users, depending on OnConflict. A dry run only
+// reports.
+func (s *Service) ImportUsers(ctx context.Context, r io.Reader, params ImportParams) (_ *ImportReport, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ImportUsers", trace.WithAttributes(
+		attribute.String("import.format", params.Format),
+		attribute.Bool("import.dry_run", params.DryRun),
+	))
+	defer func() { endSpan(span, err) }()
+	if err := validateImportParams(&params); err != nil {
+		return nil, err
+	}
+	report := &ImportReport{DryRun: params.DryRun}
+	var rows []importRow
+	if params.Format == ImportCSV {
+		rows, err = parseCSV(r, params.Mapping, report)
+	} else {
+		rows, err = parseNDJSON(r, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Rows = len(rows) + len(report.Errors)
+	valid := checkRows(rows, report)
+	if report.Rows == 0 {
+		return nil, fmt.Errorf("%w: no rows", ErrInvalidImport)
+	}
+	if len(valid) == 0 {
+		return report, nil
+	}
+	if err := s.findConflicts(ctx, valid, params.OnConflict, report); err != nil {
+		return nil, err
+	}
+	if len(report.Errors) > 0 || params.DryRun {
+		return report, nil
+	}
+	if err := s.importRows(ctx, valid, params.OnConflict, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func parseCSV(r io.Reader, mapping map[string]string, report *ImportReport) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	columns := make(map[string]int, len(importFields))
+	for _, field := range importFields {
+		column := field
+		if c, ok := mapping[field]; ok {
+			column = c
+		}
+		i := slices.Index(header, column)
+		if i < 0 {
+			if field == "name" || mapping[field] != "" {
+				return nil, fmt.Errorf("%w: missing column %q", ErrInvalidImport, column)
+			}
+			continue
+		}
+		columns[field] = i
+	}
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		if len(rows)+len(report.Errors) == MaxImportRows {
+			return nil, fmt.Errorf("%w: import must have at most %d rows", ErrInvalidImport, MaxImportRows)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			report.Errors = append(report.Errors, ImportLine{
+				Line:  line,
+				Error: fmt.Sprintf("row has %d columns, header has %d", len(record), len(header)),
+			})
+			continue
+		}
+		row := importRow{line: line, user: User{Name: record[columns["name"]]}}
+		if i, ok := columns["other"]; ok {
+			row.user.Other = record[i]
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseNDJSON(r io.Reader, report *ImportReport) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLine)
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Bytes()
+		if len(strings.TrimSpace(string(text))) == 0 {
+			continue
+		}
+		if len(rows)+len(report.Errors) == MaxImportRows {
+			return nil, fmt.Errorf("%w: import must have at most %d rows", ErrInvalidImport, MaxImportRows)
+		}
+		var user User
+		if err := json.Unmarshal(text, &user); err != nil {
+			report.Errors = append(report.Errors, ImportLine{Line: line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, importRow{line: line, user: User{Name: user.Name, Other: user.Other}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return rows, nil
+}
+
+// checkRows reports invalid rows and rows repeating a name and returns the
+// rest keyed by name.
+func checkRows(rows []importRow, report *ImportReport) map[string]importRow {
+	valid := make(map[string]importRow, len(rows))
+	for _, row := range rows {
+		if err := validateUser(row.user); err != nil {
+			report.Errors = append(report.Errors, ImportLine{Line: row.line, Name: row.user.Name, Error: err.Error()})
+			continue
+		}
+		if first, ok := valid[row.user.Name]; ok {
+			report.Errors = append(report.Errors, ImportLine{
+				Line:  row.line,
+				Name:  row.user.Name,
+				Error: fmt.Sprintf("name repeats line %d", first.line),
+			})
+			continue
+		}
+		valid[row.user.Name] = row
+	}
+	slices.SortFunc(report.Errors, func(a, b ImportLine) int { return a.Line - b.Line })
+	return valid
+}
+
+// findConflicts reports rows with names of existing users and counts what
+// the import would do.
+func (s *Service) findConflicts(ctx context.Context, valid map[string]importRow, onConflict string, report *ImportReport) error {
+	names := make([]string, 0, len(valid))
+	for name := range valid {
+		names = append(names, name)
+	}
+	existing, err := s.userRepo.GetUsersByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	for _, dbUser := range existing {
+		report.Conflicts = append(report.Conflicts, ImportLine{Line: valid[dbUser.Name].line, Name: dbUser.Name})
+	}
+	slices.SortFunc(report.Conflicts, func(a, b ImportLine) int { return a.Line - b.Line })
+	report.Created = len(valid) - len(existing)
+	if onConflict == OnConflictUpdate {
+		report.Updated = len(existing)
+	} else {
+		report.Skipped = len(existing)
+	}
+	return nil
+}
+
+// importRows writes valid rows in file order with a single statement, so
+// either all are imported or none. Counts are taken from the database as
+// users may have changed since findConflicts.
+func (s *Service) importRows(ctx context.Context, valid map[string]importRow, onConflict string, report *ImportReport) error {
+	rows := make([]importRow, 0, len(valid))
+	for _, row := range valid {
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b importRow) int { return a.line - b.line })
+	names := make([]string, len(rows))
+	others := make([]string, len(rows))
+	for i, row := range rows {
+		names[i], others[i] = row.user.Name, row.user.Other
+	}
+	if onConflict == OnConflictUpdate {
+		dbUsers, err := s.userRepo.UpsertUsersAudited(ctx, db.UpsertUsersParams{Names: names, Others: others}, auditOf(ctx))
+		if err != nil {
+			return err
+		}
+		report.Created, report.Updated = 0, 0
+		for _, dbUser := range dbUsers {
+			// Only updated users have updated_at set by the statement.
+			if dbUser.UpdatedAt.Valid {
+				report.Updated++
+			} else {
+				report.Created++
+			}
+		}
+		return nil
+	}
+	dbUsers, err := s.userRepo.CreateUsersAudited(ctx, db.CreateUsersParams{Names: names, Others: others}, auditOf(ctx))
+	if err != nil {
+		return err
+	}
+	report.Created = len(dbUsers)
+	report.Skipped = len(rows) - len(dbUsers)
+	return nil
+}
@@ -12,25 +12,40 @@ type User struct {
 	Other     string     `json:"other"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Version is incremented on every update and served as ETag.
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func FromDBUser(dbUser db.User) *User {
-	var updatedAt *time.Time
+	var updatedAt, deletedAt *time.Time
 	if dbUser.UpdatedAt.Valid {
 		updatedAt = &dbUser.UpdatedAt.Time
 	}
+	if dbUser.DeletedAt.Valid {
+		deletedAt = &dbUser.DeletedAt.Time
+	}
 	return &User{
 		ID:        dbUser.ID,
 		Name:      dbUser.Name,
 		Other:     dbUser.Other.String,
 		CreatedAt: dbUser.CreatedAt.Time,
 		UpdatedAt: updatedAt,
+		Version:   dbUser.Version,
+		DeletedAt: deletedAt,
 	}
 }
 
 type UsersResponse struct {
-	Users []*User `json:"users"`
-	Count int     `json:"count"`
+	Users          []*User `json:"users"`
+	Count          int     `json:"count"`
+	Total          *int64  `json:"total,omitempty"`
+	TotalEstimated bool    `json:"total_estimated,omitempty"`
+	Limit          int32   `json:"limit"`
+	Offset         int32   `json:"offset"`
+	HasMore        bool    `json:"has_more"`
+	NextCursor     string  `json:"next_cursor,omitempty"`
+	PrevCursor     string  `json:"prev_cursor,omitempty"`
 }
 
 func FromDBUsers(dbUser []db.User) *UsersResponse {
@@ -43,3 +58,35 @@ func FromDBUsers(dbUser []db.User) *UsersResponse {
 		Count: len(dbUser),
 	}
 }
+
+// SearchResult is a user found by search with its relevance score from 0 to 1.
+type SearchResult struct {
+	*User
+	Score float32 `json:"score"`
+}
+
+type SearchResponse struct {
+	Users []*SearchResult `json:"users"`
+	Count int             `json:"count"`
+}
+
+func FromDBSearchRows(rows []db.SearchUsersRow) *SearchResponse {
+	users := make([]*SearchResult, len(rows))
+	for i, row := range rows {
+		users[i] = &SearchResult{
+			User: FromDBUser(db.User{
+				ID:        row.ID,
+				Name:      row.Name,
+				Other:     row.Other,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Version:   row.Version,
+			}),
+			Score: row.Score,
+		}
+	}
+	return &SearchResponse{
+		Users: users,
+		Count: len(rows),
+	}
+}
@@ -0,0 +1,136 @@
+package logic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const MaxLimit = 100
+
+// Total modes of ListParams.
+const (
+	TotalExact    = "exact"
+	TotalEstimate = "estimate"
+	TotalNone     = "none"
+)
+
+var ErrInvalidPagination = errors.New("invalid pagination")
+
+// ListParams selects a page either by Offset or by an opaque Cursor taken
+// from next_cursor or prev_cursor of a previous page.
+type ListParams struct {
+	Limit  int32
+	Offset int32
+	Cursor string
+	// Total is TotalExact (default), TotalEstimate from pg_class statistics
+	// for large tables, or TotalNone to skip counting.
+	Total  string
+	Filter Filter
+	// Sort is a comma separated list of columns, see parseSort.
+	Sort string
+}
+
+// cursor points at the user a page starts after, or ends before when
+// Before is set, in Sort order. It holds values of the sort columns of that
+// user. Last selects the last page without pointing at a user.
+type cursor struct {
+	CreatedAt time.Time  `json:"t,omitempty"`
+	ID        int64      `json:"i,omitempty"`
+	Name      string     `json:"n,omitempty"`
+	UpdatedAt *time.Time `json:"u,omitempty"`
+	Sort      string     `json:"s,omitempty"`
+	Before    bool       `json:"b,omitempty"`
+	Last      bool       `json:"l,omitempty"`
+}
+
+func validateListParams(params ListParams) error {
+	if params.Limit < 1 || params.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPagination, MaxLimit)
+	}
+	if params.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidPagination)
+	}
+	if params.Cursor != "" && params.Offset != 0 {
+		return fmt.Errorf("%w: cursor and offset cannot be combined", ErrInvalidPagination)
+	}
+	switch params.Total {
+	case "", TotalExact, TotalEstimate, TotalNone:
+	default:
+		return fmt.Errorf("%w: total must be %s, %s or %s", ErrInvalidPagination, TotalExact, TotalEstimate, TotalNone)
+	}
+	return nil
+}
+
+// LastPageCursor selects the last page in sort order.
+func LastPageCursor(sort string) string {
+	keys, err := parseSort(sort)
+	if err != nil {
+		return ""
+	}
+	return encodeCursor(cursor{Sort: formatSort(keys), Before: true, Last: true})
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPagination)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPagination)
+	}
+	if !c.Last && (c.ID == 0 || c.CreatedAt.IsZero()) {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPagination)
+	}
+	return c, nil
+}
+
+func cursorAfter(user db.User, sort []db.SortKey) string {
+	return encodeCursor(newCursor(user, sort, false))
+}
+
+func cursorBefore(user db.User, sort []db.SortKey) string {
+	return encodeCursor(newCursor(user, sort, true))
+}
+
+func newCursor(user db.User, sort []db.SortKey, before bool) cursor {
+	key := db.KeyOf(user)
+	c := cursor{
+		CreatedAt: key.CreatedAt.Time,
+		ID:        key.ID,
+		Sort:      formatSort(sort),
+		Before:    before,
+	}
+	for _, k := range sort {
+		switch k.Column {
+		case db.SortName:
+			c.Name = key.Name
+		case db.SortUpdatedAt:
+			c.UpdatedAt = &key.UpdatedAt.Time
+		}
+	}
+	return c
+}
+
+func (c cursor) key() *db.UserKey {
+	key := &db.UserKey{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: pgtype.Timestamp{Time: c.CreatedAt, Valid: true},
+	}
+	if c.UpdatedAt != nil {
+		key.UpdatedAt = pgtype.Timestamp{Time: *c.UpdatedAt, Valid: true}
+	}
+	return key
+}
@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bmcszk/user-service/db"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Patch types, named after their media types.
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+var ErrInvalidPatch = errors.New("invalid patch")
+var ErrUnsupportedPatch = errors.New("unsupported patch type")
+
+// patchDocument is the patchable part of a user. Other is nullable, so it
+// is cleared with an explicit null.
+type patchDocument struct {
+	Name  *string `json:"name"`
+	Other *string `json:"other"`
+}
+
+func validatePatchType(patchType string) error {
+	if patchType != MergePatch && patchType != JSONPatch {
+		return fmt.Errorf("%w: must be %s or %s", ErrUnsupportedPatch, MergePatch, JSONPatch)
+	}
+	return nil
+}
+
+// applyPatch patches name and other of dbUser, rejecting any other field.
+func applyPatch(dbUser db.User, patchType string, patch []byte) (db.UpdateUserParams, error) {
+	doc := patchDocument{Name: &dbUser.Name}
+	if dbUser.Other.Valid {
+		doc.Other = &dbUser.Other.String
+	}
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return db.UpdateUserParams{}, err
+	}
+	var patched []byte
+	switch patchType {
+	case MergePatch:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case JSONPatch:
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		return db.UpdateUserParams{}, validatePatchType(patchType)
+	}
+	if err != nil {
+		return db.UpdateUserParams{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	var result patchDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		return db.UpdateUserParams{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	if result.Name == nil {
+		return db.UpdateUserParams{}, fmt.Errorf("%w: name cannot be null", ErrUserNameEmpty)
+	}
+	params := db.UpdateUserParams{
+		ID:   dbUser.ID,
+		Name: *result.Name,
+	}
+	user := User{Name: params.Name}
+	if result.Other != nil {
+		params.Other = pgtype.Text{String: *result.Other, Valid: true}
+		user.Other = *result.Other
+	}
+	if err := validateUser(user); err != nil {
+		return db.UpdateUserParams{}, err
+	}
+	return params, nil
+}
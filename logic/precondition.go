@@ -0,0 +1,39 @@
+package logic
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrVersionMismatch = errors.New("user version mismatch")
+var ErrPreconditionRequired = errors.New("precondition required")
+
+// Precondition holds the user versions a write expects, taken from If-Match.
+// Any matches every version. A nil Precondition means If-Match was not sent.
+type Precondition struct {
+	Any      bool
+	Versions []int64
+}
+
+// versions returns the versions a write is conditioned on, nil for any.
+// A precondition without versions matches none.
+func (p *Precondition) versions() []int64 {
+	if p == nil || p.Any {
+		return nil
+	}
+	if p.Versions == nil {
+		return []int64{}
+	}
+	return p.Versions
+}
+
+func (p *Precondition) matches(version int64) bool {
+	return p == nil || p.Any || slices.Contains(p.Versions, version)
+}
+
+func (s *Service) checkPreconditionRequired(pre *Precondition) error {
+	if pre == nil && s.requirePrecondition {
+		return ErrPreconditionRequired
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+)
+
+const maxSearchQueryLength = 255
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+// SearchParams finds users by name similarity, tolerating typos and partial
+// names, or by words of name and other.
+type SearchParams struct {
+	Query string
+	Limit int32
+}
+
+func validateSearchParams(params SearchParams) error {
+	if params.Query == "" {
+		return fmt.Errorf("%w: query must not be empty", ErrInvalidSearch)
+	}
+	if len(params.Query) > maxSearchQueryLength {
+		return fmt.Errorf("%w: query must be at most %d bytes", ErrInvalidSearch, maxSearchQueryLength)
+	}
+	if params.Limit < 1 || params.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, MaxLimit)
+	}
+	return nil
+}
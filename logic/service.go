@@ -3,11 +3,17 @@ package logic
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/tracing"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const DuplicateErrorCode = "23505"
@@ -15,33 +21,102 @@ const DuplicateErrorCode = "23505"
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserAlreadyExists = errors.New("user already exists")
 var ErrUserNameEmpty = errors.New("user name empty")
+var ErrUserNotDeleted = errors.New("user not deleted")
+
+var tracer = tracing.Tracer("github.com/bmcszk/user-service/logic")
+
+// endSpan ends a span of a Service method, marking it failed when the
+// method returns err.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	span.End()
+}
 
 type userRepo interface {
-	CreateUser(context.Context, db.CreateUserParams) (db.User, error)
-	GetUser(context.Context, int64) (db.User, error)
-	UpdateUser(context.Context, db.UpdateUserParams) (db.User, error)
-	DeleteUser(context.Context, int64) error
+	CreateUserAudited(context.Context, db.CreateUserParams, db.Audit) (db.User, error)
+	CreateUsersAudited(context.Context, db.CreateUsersParams, db.Audit) ([]db.User, error)
+	CopyUsersAtomic(context.Context, []db.CopyUsersParams, db.Audit) ([]db.User, error)
+	GetUsersByNames(context.Context, []string) ([]db.User, error)
+	UpsertUsersAudited(context.Context, db.UpsertUsersParams, db.Audit) ([]db.User, error)
+	BulkSetUsersOther(context.Context, db.BulkParams, pgtype.Text, db.Audit) ([]int64, error)
+	BulkDeleteUsers(context.Context, db.BulkParams, db.Audit) ([]int64, error)
+	CountBulkUsers(context.Context, db.BulkParams) (int64, error)
+	GetUser(context.Context, db.GetUserParams) (db.User, error)
+	GetUserAsOf(context.Context, db.GetUserAsOfParams) (db.GetUserAsOfRow, error)
+	UpdateUserAudited(context.Context, db.UpdateUserParams, db.Audit) (db.User, error)
+	DeleteUserAudited(context.Context, db.DeleteUserParams, db.Audit) (int64, error)
+	RestoreUserAudited(context.Context, int64, db.Audit) (db.User, error)
+	PurgeUserAudited(context.Context, int64, db.Audit) (int64, error)
 	ListUsers(context.Context, db.ListUsersParams) ([]db.User, error)
+	CountUsers(context.Context, db.UserFilter) (int64, error)
+	ExportUsers(context.Context, db.UserFilter, func(db.User) error) error
+	SearchUsers(context.Context, db.SearchUsersParams) ([]db.SearchUsersRow, error)
+	EstimateUsersCount(context.Context) (int64, error)
+	ListAudit(context.Context, db.ListAuditParams) ([]db.AuditLog, error)
+	CreateWebhook(context.Context, db.CreateWebhookParams) (db.Webhook, error)
+	GetWebhook(context.Context, int64) (db.Webhook, error)
+	ListWebhooks(context.Context) ([]db.Webhook, error)
+	DeleteWebhook(context.Context, int64) (int64, error)
+	ListWebhookDeliveries(context.Context, db.ListWebhookDeliveriesParams) ([]db.ListWebhookDeliveriesRow, error)
+	RedeliverWebhookDelivery(context.Context, db.RedeliverWebhookDeliveryParams) (db.WebhookDelivery, error)
 }
 
 type Service struct {
-	userRepo userRepo
+	userRepo            userRepo
+	requirePrecondition bool
+	bulkMaxRows         int32
+	checkWebhookURL     func(context.Context, string) error
+}
+
+type Option func(*Service)
+
+// WithRequiredPrecondition rejects updates and deletes without a
+// Precondition with ErrPreconditionRequired.
+func WithRequiredPrecondition() Option {
+	return func(s *Service) {
+		s.requirePrecondition = true
+	}
 }
 
-func NewService(userRepo userRepo) *Service {
-	return &Service{
-		userRepo: userRepo,
+// WithBulkMaxRows limits the users a bulk change may affect, by default
+// DefaultBulkMaxRows.
+func WithBulkMaxRows(maxRows int32) Option {
+	return func(s *Service) {
+		s.bulkMaxRows = maxRows
 	}
 }
 
-func (s *Service) CreateUser(ctx context.Context, user User) (*User, error) {
+// WithWebhookURLCheck rejects webhooks whose url fails check with
+// ErrInvalidWebhook, e.g. one resolving to an internal address.
+func WithWebhookURLCheck(check func(ctx context.Context, url string) error) Option {
+	return func(s *Service) {
+		s.checkWebhookURL = check
+	}
+}
+
+func NewService(userRepo userRepo, opts ...Option) *Service {
+	s := &Service{
+		userRepo:    userRepo,
+		bulkMaxRows: DefaultBulkMaxRows,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Service) CreateUser(ctx context.Context, user User) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateUser")
+	defer func() { endSpan(span, err) }()
 	if err := validateUser(user); err != nil {
 		return nil, err
 	}
-	dbUser, err := s.userRepo.CreateUser(ctx, db.CreateUserParams{
+	dbUser, err := s.userRepo.CreateUserAudited(ctx, db.CreateUserParams{
 		Name:  user.Name,
 		Other: pgtype.Text{String: user.Other, Valid: true},
-	})
+	}, auditOf(ctx))
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == DuplicateErrorCode {
@@ -52,8 +127,14 @@ func (s *Service) CreateUser(ctx context.Context, user User) (*User, error) {
 	return FromDBUser(dbUser), nil
 }
 
-func (s *Service) GetUserByID(ctx context.Context, id int64) (*User, error) {
-	dbUser, err := s.userRepo.GetUser(ctx, id)
+// GetUserByID returns a live user, or a soft deleted one with includeDeleted.
+func (s *Service) GetUserByID(ctx context.Context, id int64, includeDeleted bool) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	dbUser, err := s.userRepo.GetUser(ctx, db.GetUserParams{
+		ID:             id,
+		IncludeDeleted: includeDeleted,
+	})
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -63,15 +144,120 @@ func (s *Service) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	return FromDBUser(dbUser), nil
 }
 
-func (s *Service) UpdateUserByID(ctx context.Context, id int64, user User) (*User, error) {
+// GetUserAsOf returns the user as it was at asOf, reconstructed from its
+// history. It fails with ErrUserNotFound when the user did not exist or,
+// without includeDeleted, was deleted at that time.
+func (s *Service) GetUserAsOf(ctx context.Context, id int64, asOf time.Time, includeDeleted bool) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetUserAsOf", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	row, err := s.userRepo.GetUserAsOf(ctx, db.GetUserAsOfParams{
+		ID:             id,
+		AsOf:           toTimestamp(&asOf),
+		IncludeDeleted: includeDeleted,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return FromDBUser(db.User(row)), nil
+}
+
+// UpdateUserByID replaces the user if it matches pre.
+func (s *Service) UpdateUserByID(ctx context.Context, id int64, user User, pre *Precondition) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.UpdateUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPreconditionRequired(pre); err != nil {
+		return nil, err
+	}
 	if err := validateUser(user); err != nil {
 		return nil, err
 	}
-	dbUser, err := s.userRepo.UpdateUser(ctx, db.UpdateUserParams{
-		ID:    id,
-		Name:  user.Name,
-		Other: pgtype.Text{String: user.Other, Valid: true},
+	return s.updateUser(ctx, db.UpdateUserParams{
+		ID:       id,
+		Name:     user.Name,
+		Other:    pgtype.Text{String: user.Other, Valid: true},
+		Versions: pre.versions(),
 	})
+}
+
+// PatchUserByID applies a JSON Merge Patch (RFC 7396) or a JSON Patch
+// (RFC 6902), by patchType, to name and other of the user if it matches pre.
+// The user is updated only if it has not changed since it was patched.
+func (s *Service) PatchUserByID(ctx context.Context, id int64, patchType string, patch []byte, pre *Precondition) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.PatchUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPreconditionRequired(pre); err != nil {
+		return nil, err
+	}
+	if err := validatePatchType(patchType); err != nil {
+		return nil, err
+	}
+	dbUser, err := s.userRepo.GetUser(ctx, db.GetUserParams{ID: id})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !pre.matches(dbUser.Version) {
+		return nil, ErrVersionMismatch
+	}
+	params, err := applyPatch(dbUser, patchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	params.Versions = []int64{dbUser.Version}
+	return s.updateUser(ctx, params)
+}
+
+func (s *Service) updateUser(ctx context.Context, params db.UpdateUserParams) (*User, error) {
+	dbUser, err := s.userRepo.UpdateUserAudited(ctx, params, auditOf(ctx))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, s.notFoundOrMismatch(ctx, params.ID, params.Versions)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == DuplicateErrorCode {
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, err
+	}
+	return FromDBUser(dbUser), nil
+}
+
+// DeleteUserByID soft deletes the user if it matches pre. The user can be
+// restored until purged.
+func (s *Service) DeleteUserByID(ctx context.Context, id int64, pre *Precondition) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	if err := s.checkPreconditionRequired(pre); err != nil {
+		return err
+	}
+	versions := pre.versions()
+	deleted, err := s.userRepo.DeleteUserAudited(ctx, db.DeleteUserParams{
+		ID:       id,
+		Versions: versions,
+	}, auditOf(ctx))
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return s.notFoundOrMismatch(ctx, id, versions)
+	}
+	return nil
+}
+
+// RestoreUserByID undeletes a soft deleted user. Restoring a live user
+// returns it unchanged.
+func (s *Service) RestoreUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "Service.RestoreUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	dbUser, err := s.userRepo.RestoreUserAudited(ctx, id, auditOf(ctx))
+	if err == pgx.ErrNoRows {
+		dbUser, err = s.userRepo.GetUser(ctx, db.GetUserParams{ID: id})
+	}
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -85,25 +271,197 @@ func (s *Service) UpdateUserByID(ctx context.Context, id int64, user User) (*Use
 	return FromDBUser(dbUser), nil
 }
 
-func (s *Service) DeleteUserByID(ctx context.Context, id int64) error {
-	if err := s.userRepo.DeleteUser(ctx, id); err != nil {
+// PurgeUserByID permanently removes a soft deleted user.
+func (s *Service) PurgeUserByID(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.PurgeUserByID", trace.WithAttributes(attribute.Int64("user.id", id)))
+	defer func() { endSpan(span, err) }()
+	purged, err := s.userRepo.PurgeUserAudited(ctx, id, auditOf(ctx))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		return nil
+	}
+	if _, err := s.userRepo.GetUser(ctx, db.GetUserParams{ID: id}); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return ErrUserNotDeleted
+}
+
+// notFoundOrMismatch tells why a write conditioned on versions matched no user.
+func (s *Service) notFoundOrMismatch(ctx context.Context, id int64, versions []int64) error {
+	if versions == nil {
+		return ErrUserNotFound
+	}
+	if _, err := s.userRepo.GetUser(ctx, db.GetUserParams{ID: id}); err != nil {
 		if err == pgx.ErrNoRows {
 			return ErrUserNotFound
 		}
 		return err
 	}
-	return nil
+	return ErrVersionMismatch
+}
+
+func (s *Service) ListUsers(ctx context.Context, params ListParams) (_ *UsersResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListUsers")
+	defer func() { endSpan(span, err) }()
+	if err := validateListParams(params); err != nil {
+		return nil, err
+	}
+	if err := validateFilter(params.Filter); err != nil {
+		return nil, err
+	}
+	sort, err := parseSort(params.Sort)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.listUsersPage(ctx, params, sort)
+	if err != nil {
+		return nil, err
+	}
+	res.Limit = params.Limit
+	res.Offset = params.Offset
+	res.HasMore = res.NextCursor != ""
+	if res.Total, res.TotalEstimated, err = s.countUsers(ctx, params); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// listUsersPage fetches one extra row to know if there is a further page.
+func (s *Service) listUsersPage(ctx context.Context, params ListParams, sort []db.SortKey) (*UsersResponse, error) {
+	query := db.ListUsersParams{
+		Filter: params.Filter.toDB(),
+		Sort:   sort,
+		Limit:  params.Limit + 1,
+	}
+	if params.Cursor == "" {
+		query.Offset = params.Offset
+		return s.listUsersByOffset(ctx, query, params.Limit)
+	}
+	c, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != formatSort(sort) {
+		return nil, fmt.Errorf("%w: cursor does not match sort", ErrInvalidPagination)
+	}
+	if !c.Last {
+		query.Key = c.key()
+	}
+	if c.Before {
+		query.Backward = true
+		return s.listUsersBefore(ctx, query, params.Limit, c.Last)
+	}
+	return s.listUsersAfter(ctx, query, params.Limit)
 }
 
-func (s *Service) ListUsers(ctx context.Context, limit, offset int32) (*UsersResponse, error) {
-	dbUsers, err := s.userRepo.ListUsers(ctx, db.ListUsersParams{
-		Limit:  limit,
-		Offset: offset,
+// countUsers returns the total number of matching users and whether it is an
+// estimate. The estimate covers the whole table, so it falls back to exact
+// count when filtering, as well as for tables never analyzed.
+func (s *Service) countUsers(ctx context.Context, params ListParams) (*int64, bool, error) {
+	if params.Total == TotalNone {
+		return nil, false, nil
+	}
+	if params.Total == TotalEstimate && params.Filter == (Filter{}) {
+		estimate, err := s.userRepo.EstimateUsersCount(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		if estimate >= 0 {
+			return &estimate, true, nil
+		}
+	}
+	total, err := s.userRepo.CountUsers(ctx, params.Filter.toDB())
+	if err != nil {
+		return nil, false, err
+	}
+	return &total, false, nil
+}
+
+func (s *Service) listUsersByOffset(ctx context.Context, query db.ListUsersParams, limit int32) (*UsersResponse, error) {
+	dbUsers, err := s.userRepo.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	dbUsers, hasMore := trimPage(dbUsers, limit)
+	res := FromDBUsers(dbUsers)
+	if len(dbUsers) == 0 {
+		return res, nil
+	}
+	if hasMore {
+		res.NextCursor = cursorAfter(dbUsers[len(dbUsers)-1], query.Sort)
+	}
+	if query.Offset > 0 {
+		res.PrevCursor = cursorBefore(dbUsers[0], query.Sort)
+	}
+	return res, nil
+}
+
+func (s *Service) listUsersAfter(ctx context.Context, query db.ListUsersParams, limit int32) (*UsersResponse, error) {
+	dbUsers, err := s.userRepo.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	dbUsers, hasMore := trimPage(dbUsers, limit)
+	res := FromDBUsers(dbUsers)
+	if len(dbUsers) == 0 {
+		return res, nil
+	}
+	if hasMore {
+		res.NextCursor = cursorAfter(dbUsers[len(dbUsers)-1], query.Sort)
+	}
+	res.PrevCursor = cursorBefore(dbUsers[0], query.Sort)
+	return res, nil
+}
+
+// listUsersBefore lists backward, so the page is reversed. The last page
+// has no next page.
+func (s *Service) listUsersBefore(ctx context.Context, query db.ListUsersParams, limit int32, last bool) (*UsersResponse, error) {
+	dbUsers, err := s.userRepo.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	dbUsers, hasMore := trimPage(dbUsers, limit)
+	slices.Reverse(dbUsers)
+	res := FromDBUsers(dbUsers)
+	if len(dbUsers) == 0 {
+		return res, nil
+	}
+	if hasMore {
+		res.PrevCursor = cursorBefore(dbUsers[0], query.Sort)
+	}
+	if !last {
+		res.NextCursor = cursorAfter(dbUsers[len(dbUsers)-1], query.Sort)
+	}
+	return res, nil
+}
+
+// SearchUsers returns users ranked by relevance to the query.
+func (s *Service) SearchUsers(ctx context.Context, params SearchParams) (_ *SearchResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.SearchUsers")
+	defer func() { endSpan(span, err) }()
+	if err := validateSearchParams(params); err != nil {
+		return nil, err
+	}
+	rows, err := s.userRepo.SearchUsers(ctx, db.SearchUsersParams{
+		Query:    params.Query,
+		RowLimit: params.Limit,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return FromDBUsers(dbUsers), nil
+	return FromDBSearchRows(rows), nil
+}
+
+func trimPage(dbUsers []db.User, limit int32) ([]db.User, bool) {
+	if len(dbUsers) > int(limit) {
+		return dbUsers[:limit], true
+	}
+	return dbUsers, false
 }
 
 func validateUser(user User) error {
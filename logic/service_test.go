@@ -1,7 +1,14 @@
 package logic
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func TestService_CreateUser(t *testing.T) {
@@ -35,6 +42,442 @@ func TestService_CreateUser_InvalidUser(t *testing.T) {
 	then.returnedErrorIs(ErrUserNameEmpty)
 }
 
+func TestService_CreatesUsers(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch("kapitan", "porucznik").and().
+		dbCanCreateUsers()
+
+	when.serviceCreatesUsers(false)
+
+	then.noError().and().
+		batchResultsAre(nil, nil)
+}
+
+func TestService_CreatesUsers_PartialFailure(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch("kapitan", "", "kapitan", "taken").and().
+		dbCanCreateUsers("taken")
+
+	when.serviceCreatesUsers(false)
+
+	then.noError().and().
+		batchResultsAre(nil, ErrUserNameEmpty, ErrUserAlreadyExists, ErrUserAlreadyExists)
+}
+
+func TestService_CreatesUsers_Atomic(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch("kapitan", "porucznik").and().
+		dbCanCopyUsers()
+
+	when.serviceCreatesUsers(true)
+
+	then.noError().and().
+		batchResultsAre(nil, nil)
+}
+
+func TestService_CreatesUsers_AtomicInvalid(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch("kapitan", "")
+
+	when.serviceCreatesUsers(true)
+
+	then.noError().and().
+		batchResultsAre(ErrBatchAborted, ErrUserNameEmpty)
+}
+
+func TestService_CreatesUsers_AtomicTakenName(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch("kapitan", "taken").and().
+		dbCannotCopyUsersWithTakenName("taken")
+
+	when.serviceCreatesUsers(true)
+
+	then.noError().and().
+		batchResultsAre(ErrBatchAborted, ErrUserAlreadyExists)
+}
+
+func TestService_CreatesUsers_Empty(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBatch()
+
+	when.serviceCreatesUsers(false)
+
+	then.returnedErrorIs(ErrInvalidBatch)
+}
+
+func TestService_BulkUpdatesUsers(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByIDs(1, 2).and().
+		aBulkOther(`"retired"`).and().
+		dbCanBulkChangeUsers(1, 2)
+
+	when.serviceBulkUpdatesUsers()
+
+	then.noError().and().
+		bulkResultIs(false, 1, 2).and().
+		dbBulkOtherIs(pgtype.Text{String: "retired", Valid: true})
+}
+
+func TestService_BulkUpdatesUsers_ClearsOtherByFilter(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByFilter(Filter{NamePrefix: "adm"}).and().
+		aBulkOther("null").and().
+		dbCanBulkChangeUsers(3)
+
+	when.serviceBulkUpdatesUsers()
+
+	then.noError().and().
+		bulkResultIs(false, 3).and().
+		dbBulkOtherIs(pgtype.Text{}).and().
+		dbBulkFilterIs(db.UserFilter{NamePrefix: "adm"})
+}
+
+func TestService_BulkUpdatesUsers_MissingOther(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByIDs(1)
+
+	when.serviceBulkUpdatesUsers()
+
+	then.returnedErrorIs(ErrInvalidBulk)
+}
+
+func TestService_BulkDeletesUsers_DryRun(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByIDs(1, 2).and().
+		aDryRun().and().
+		dbCanBulkChangeUsers(1).and().
+		dbCountsBulkUsers(1)
+
+	when.serviceBulkDeletesUsers()
+
+	then.noError().and().
+		bulkResultIs(true, 1)
+}
+
+func TestService_BulkDeletesUsers_DryRunOverLimit(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.serviceAllowsBulkRows(2).and().
+		aBulkByFilter(Filter{NamePrefix: "adm"}).and().
+		aDryRun().and().
+		dbCanBulkChangeUsers(1, 2).and().
+		dbCountsBulkUsers(5)
+
+	when.serviceBulkDeletesUsers()
+
+	then.noError().and().
+		bulkResultCounts(true, 5, true, 1, 2)
+}
+
+func TestService_BulkDeletesUsers_EmptyFilter(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByFilter(Filter{})
+
+	when.serviceBulkDeletesUsers()
+
+	then.returnedErrorIs(ErrInvalidBulk)
+}
+
+func TestService_BulkDeletesUsers_RecordsActor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByIDs(1, 2).and().
+		anActor("admin").and().
+		dbCanBulkChangeUsers(1, 2)
+
+	when.serviceBulkDeletesUsers()
+
+	then.noError().and().
+		bulkResultIs(false, 1, 2).and().
+		auditIs("admin", "request-1")
+}
+
+func TestService_BulkDeletesUsers_IDsAndFilter(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByIDs(1).and().
+		aBulkByFilter(Filter{})
+
+	when.serviceBulkDeletesUsers()
+
+	then.returnedErrorIs(ErrInvalidBulk)
+}
+
+func TestService_BulkDeletesUsers_TooManyIDs(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.serviceAllowsBulkRows(1).and().
+		aBulkByIDs(1, 2)
+
+	when.serviceBulkDeletesUsers()
+
+	then.returnedErrorIs(ErrTooManyUsers)
+}
+
+func TestService_BulkDeletesUsers_TooManySelected(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aBulkByFilter(Filter{NamePrefix: "adm"}).and().
+		dbSelectsTooManyUsers()
+
+	when.serviceBulkDeletesUsers()
+
+	then.returnedErrorIs(ErrTooManyUsers)
+}
+
+func TestService_ExportsUsers(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anExportOf("id", "name").and().
+		dbCanExportUsers(3)
+
+	when.serviceExportsUsers()
+
+	then.noError().and().
+		exportedUsersAre(1, 2, 3)
+}
+
+func TestService_ExportsUsers_Stopped(t *testing.T) {
+	stopped := errors.New("client gone")
+	given, when, then := NewBlocks(t)
+	given.dbCanExportUsers(3)
+
+	when.serviceExportsUsersUntil(stopped)
+
+	then.returnedErrorIs(stopped).and().
+		exportedUsersAre(1)
+}
+
+func TestService_ExportsUsers_UnknownColumn(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anExportOf("id", "password")
+
+	when.serviceExportsUsers()
+
+	then.returnedErrorIs(ErrInvalidExport)
+}
+
+func TestService_ImportsUsers_CSV(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anImport(ImportParams{Format: ImportCSV, Mapping: map[string]string{"name": "login"}},
+		"login,other\nkapitan,navy\ntaken,army\n").and().
+		dbHasUsersNamed("taken").and().
+		dbCanCreateUsers("taken")
+
+	when.serviceImportsUsers()
+
+	then.noError().and().
+		importReportIs(ImportReport{
+			Rows: 2, Created: 1, Skipped: 1,
+			Conflicts: []ImportLine{{Line: 3, Name: "taken"}},
+		})
+}
+
+func TestService_ImportsUsers_Upsert(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anImport(ImportParams{Format: ImportNDJSON, OnConflict: OnConflictUpdate},
+		"{\"name\":\"kapitan\"}\n\n{\"name\":\"taken\",\"other\":\"army\"}\n").and().
+		dbHasUsersNamed("taken").and().
+		dbCanUpsertUsers("taken")
+
+	when.serviceImportsUsers()
+
+	then.noError().and().
+		importReportIs(ImportReport{
+			Rows: 2, Created: 1, Updated: 1,
+			Conflicts: []ImportLine{{Line: 3, Name: "taken"}},
+		})
+}
+
+func TestService_ImportsUsers_InvalidRows(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anImport(ImportParams{Format: ImportCSV},
+		"name,other\nkapitan,navy\n,army\nkapitan,army\nmajor\n").and().
+		dbHasUsersNamed()
+
+	when.serviceImportsUsers()
+
+	then.noError().and().
+		importReportIs(ImportReport{
+			Rows: 4, Created: 1,
+			Errors: []ImportLine{
+				{Line: 3, Error: ErrUserNameEmpty.Error()},
+				{Line: 4, Name: "kapitan", Error: "name repeats line 2"},
+				{Line: 5, Error: "row has 1 columns, header has 2"},
+			},
+		})
+}
+
+func TestService_ImportsUsers_DryRun(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anImport(ImportParams{Format: ImportNDJSON, OnConflict: OnConflictUpdate, DryRun: true},
+		"{\"name\":\"kapitan\"}\n{\"name\":\"taken\"}\n").and().
+		dbHasUsersNamed("taken")
+
+	when.serviceImportsUsers()
+
+	then.noError().and().
+		importReportIs(ImportReport{
+			Rows: 2, Created: 1, Updated: 1, DryRun: true,
+			Conflicts: []ImportLine{{Line: 2, Name: "taken"}},
+		})
+}
+
+func TestService_ImportsUsers_MissingColumn(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anImport(ImportParams{Format: ImportCSV, Mapping: map[string]string{"name": "login"}},
+		"name,other\nkapitan,navy\n")
+
+	when.serviceImportsUsers()
+
+	then.returnedErrorIs(ErrInvalidImport)
+}
+
+func TestService_CreateUser_RecordsActor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aUser().and().
+		anActor("admin").and().
+		dbCanCreateUser()
+
+	when.serviceCreatesUser()
+
+	then.noError().and().
+		auditIs("admin", "request-1")
+}
+
+func TestService_DeletesUser_AnonymousActor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbCanDeleteUser()
+
+	when.serviceDeletesUser()
+
+	then.noError().and().
+		auditIs(AnonymousActor, "request-1")
+}
+
+func TestService_ListsAudit(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anAuditPage(2, "").and().
+		dbHasAuditEntries(3)
+
+	when.serviceListsAudit()
+
+	then.noError().and().
+		auditEntriesAre(3, 2).and().
+		nextAuditPageIsRequested().and().
+		noError().and().
+		auditEntriesAre(1)
+}
+
+func TestService_ListsAudit_InvalidAction(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.anAuditPage(2, "").and().
+		anAuditAction("read")
+
+	when.serviceListsAudit()
+
+	then.returnedErrorIs(ErrInvalidFilter)
+}
+
+func TestService_GetsUserHistory_NotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		anAuditPage(10, "").and().
+		dbHasAuditEntries(0).and().
+		dbCannotFindUser()
+
+	when.serviceGetsUserHistory()
+
+	then.returnedErrorIs(ErrUserNotFound)
+}
+
+func TestService_CreatesWebhook(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aWebhook("https://example.com/hook", "0123456789abcdef", db.EventUserUpdated, db.EventUserCreated, db.EventUserUpdated).and().
+		dbCanCreateWebhook()
+
+	when.serviceCreatesWebhook()
+
+	then.noError().and().
+		webhookIsReturned(db.EventUserCreated, db.EventUserUpdated)
+}
+
+func TestService_CreatesWebhook_Invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		secret     string
+		eventTypes []string
+	}{
+		{"relative url", "/hook", "0123456789abcdef", nil},
+		{"unsupported scheme", "ftp://example.com/hook", "0123456789abcdef", nil},
+		{"short secret", "https://example.com/hook", "secret", nil},
+		{"unknown event type", "https://example.com/hook", "0123456789abcdef", []string{"user.read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			given, when, then := NewBlocks(t)
+			given.aWebhook(tt.url, tt.secret, tt.eventTypes...)
+
+			when.serviceCreatesWebhook()
+
+			then.returnedErrorIs(ErrInvalidWebhook)
+		})
+	}
+}
+
+func TestService_CreatesWebhook_URLNotAllowed(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aWebhook("http://169.254.169.254/latest", "0123456789abcdef").and().
+		serviceRejectsWebhookURLs()
+
+	when.serviceCreatesWebhook()
+
+	then.returnedErrorIs(ErrInvalidWebhook)
+}
+
+func TestService_ListsDeliveries(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aDeliveryPage(2, db.DeliveryDead).and().
+		dbHasDeliveries(3)
+
+	when.serviceListsDeliveries()
+
+	then.noError().and().
+		deliveriesAre(3, 2).and().
+		nextDeliveryPageIsRequested().and().
+		noError().and().
+		deliveriesAre(1)
+}
+
+func TestService_ListsDeliveries_WebhookNotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aDeliveryPage(10, "").and().
+		dbHasDeliveries(0).and().
+		dbCannotFindWebhook()
+
+	when.serviceListsDeliveries()
+
+	then.returnedErrorIs(ErrWebhookNotFound)
+}
+
+func TestService_ListsDeliveries_InvalidStatus(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aDeliveryPage(10, "failed")
+
+	when.serviceListsDeliveries()
+
+	then.returnedErrorIs(ErrInvalidFilter)
+}
+
+func TestService_Redelivers_NotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbCannotFindDelivery()
+
+	when.serviceRedelivers()
+
+	then.returnedErrorIs(ErrDeliveryNotFound)
+}
+
 func TestService_GetsUser(t *testing.T) {
 	given, when, then := NewBlocks(t)
 	given.aID().and().
@@ -47,6 +490,18 @@ func TestService_GetsUser(t *testing.T) {
 		returnedUserIsValid()
 }
 
+func TestService_GetsUser_NotFoundFailsSpan(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.spansAreRecorded().and().
+		aID().and().
+		dbCannotFindUser()
+
+	when.serviceGetsUser()
+
+	then.returnedErrorIs(ErrUserNotFound).and().
+		spanFailed("Service.GetUserByID")
+}
+
 func TestService_GetsUser_NotFound(t *testing.T) {
 	given, when, then := NewBlocks(t)
 	given.aID().and().
@@ -57,6 +512,29 @@ func TestService_GetsUser_NotFound(t *testing.T) {
 	then.returnedErrorIs(ErrUserNotFound)
 }
 
+func TestService_GetsUserAsOf(t *testing.T) {
+	asOf := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasUserHistory()
+
+	when.serviceGetsUserAsOf(asOf)
+
+	then.noError().and().
+		userIsReturned().and().
+		dbAsOfIs(asOf.UTC())
+}
+
+func TestService_GetsUserAsOf_NotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasNoUserHistory()
+
+	when.serviceGetsUserAsOf(createdAt)
+
+	then.returnedErrorIs(ErrUserNotFound)
+}
+
 func TestService_UpdatesUser(t *testing.T) {
 	given, when, then := NewBlocks(t)
 	given.aUser().and().
@@ -102,6 +580,134 @@ func TestService_UpdatesUser_InvalidUser(t *testing.T) {
 	then.returnedErrorIs(ErrUserNameEmpty)
 }
 
+func TestService_UpdatesUser_MatchingVersion(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aUser().and().
+		aID().and().
+		aPrecondition(3).and().
+		dbHasUserVersion(3)
+
+	when.serviceUpdatesUser()
+
+	then.noError().and().
+		returnedVersionIs(4)
+}
+
+func TestService_UpdatesUser_VersionMismatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aUser().and().
+		aID().and().
+		aPrecondition(2).and().
+		dbHasUserVersion(3)
+
+	when.serviceUpdatesUser()
+
+	then.returnedErrorIs(ErrVersionMismatch)
+}
+
+func TestService_UpdatesUser_PreconditionRequired(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aUser().and().
+		aID().and().
+		serviceRequiresPrecondition()
+
+	when.serviceUpdatesUser()
+
+	then.returnedErrorIs(ErrPreconditionRequired)
+}
+
+func TestService_PatchesUser_VersionMismatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(MergePatch, `{"name": "new name"}`).and().
+		aPrecondition(2).and().
+		dbHasUserVersion(3)
+
+	when.servicePatchesUser()
+
+	then.returnedErrorIs(ErrVersionMismatch)
+}
+
+func TestService_PatchesUser_MergePatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(MergePatch, `{"name": "new name"}`).and().
+		dbCanPatchUser()
+
+	when.servicePatchesUser()
+
+	then.noError().and().
+		userIsReturned().and().
+		userIsUpdatedTo("new name", ptr("other"))
+}
+
+func TestService_PatchesUser_MergePatchClearsOther(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(MergePatch, `{"other": null}`).and().
+		dbCanPatchUser()
+
+	when.servicePatchesUser()
+
+	then.noError().and().
+		userIsUpdatedTo("name", nil)
+}
+
+func TestService_PatchesUser_JSONPatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(JSONPatch, `[{"op": "test", "path": "/name", "value": "name"}, {"op": "replace", "path": "/other", "value": "new other"}]`).and().
+		dbCanPatchUser()
+
+	when.servicePatchesUser()
+
+	then.noError().and().
+		userIsUpdatedTo("name", ptr("new other"))
+}
+
+func TestService_PatchesUser_ReadOnlyField(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(MergePatch, `{"id": 8}`).and().
+		dbCanPatchUser()
+
+	when.servicePatchesUser()
+
+	then.returnedErrorIs(ErrInvalidPatch)
+}
+
+func TestService_PatchesUser_NullName(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(JSONPatch, `[{"op": "remove", "path": "/name"}]`).and().
+		dbCanPatchUser()
+
+	when.servicePatchesUser()
+
+	then.returnedErrorIs(ErrUserNameEmpty)
+}
+
+func TestService_PatchesUser_UnsupportedType(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch("application/json", `{"name": "new name"}`)
+
+	when.servicePatchesUser()
+
+	then.returnedErrorIs(ErrUnsupportedPatch)
+}
+
+func TestService_PatchesUser_NotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPatch(MergePatch, `{"name": "new name"}`).and().
+		dbCannotFindUser()
+
+	when.servicePatchesUser()
+
+	then.returnedErrorIs(ErrUserNotFound)
+}
+
 func TestService_DeletesUser(t *testing.T) {
 	given, when, then := NewBlocks(t)
 	given.aID().and().
@@ -122,13 +728,326 @@ func TestService_DeletesUser_NotFound(t *testing.T) {
 	then.returnedErrorIs(ErrUserNotFound)
 }
 
+func TestService_DeletesUser_VersionMismatch(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		aPrecondition(2).and().
+		dbHasUserVersion(3)
+
+	when.serviceDeletesUser()
+
+	then.returnedErrorIs(ErrVersionMismatch)
+}
+
+func TestService_GetsUser_Deleted(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasDeletedUser()
+
+	when.serviceGetsUser()
+
+	then.returnedErrorIs(ErrUserNotFound)
+}
+
+func TestService_GetsUser_IncludingDeleted(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasDeletedUser()
+
+	when.serviceGetsUserIncludingDeleted()
+
+	then.noError().and().
+		returnedUserIsDeleted()
+}
+
+func TestService_RestoresUser(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasDeletedUser()
+
+	when.serviceRestoresUser()
+
+	then.noError().and().
+		returnedUserIsLive()
+}
+
+func TestService_RestoresUser_Live(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasLiveUser()
+
+	when.serviceRestoresUser()
+
+	then.noError().and().
+		returnedUserIsLive()
+}
+
+func TestService_RestoresUser_NotFound(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbCannotFindUser()
+	given.queries.restoreUser = func(ctx context.Context, id int64) (db.User, error) {
+		return db.User{}, pgx.ErrNoRows
+	}
+
+	when.serviceRestoresUser()
+
+	then.returnedErrorIs(ErrUserNotFound)
+}
+
+func TestService_PurgesUser(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasDeletedUser()
+
+	when.servicePurgesUser()
+
+	then.noError()
+}
+
+func TestService_PurgesUser_RecordsActor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		anActor("admin").and().
+		dbHasDeletedUser()
+
+	when.servicePurgesUser()
+
+	then.noError().and().
+		auditIs("admin", "request-1")
+}
+
+func TestService_PurgesUser_Live(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aID().and().
+		dbHasLiveUser()
+
+	when.servicePurgesUser()
+
+	then.returnedErrorIs(ErrUserNotDeleted)
+}
+
 func TestService_ListsUsers(t *testing.T) {
 	given, when, then := NewBlocks(t)
-	given.dbCanListUsers()
+	given.dbCanListUsers().and().
+		dbCanCountUsers(2)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		usersAreReturned().and().
+		returnedUsersAreValid().and().
+		noNextCursorIsReturned().and().
+		noPrevCursorIsReturned().and().
+		totalIs(2, false).and().
+		hasMoreIs(false)
+}
+
+func TestService_ListsUsers_FirstPage(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aPageLimit(1).and().
+		dbCanListUsers().and().
+		dbCanCountUsers(2)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		usersAreReturned().and().
+		returnedUsersAreValid().and().
+		nextCursorIsReturned().and().
+		noPrevCursorIsReturned().and().
+		hasMoreIs(true)
+}
+
+func TestService_ListsUsers_AfterCursor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aCursorAfter().and().
+		dbCanListUsersAfter().and().
+		dbCanCountUsers(3)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		usersAreReturned().and().
+		returnedUsersAreValid().and().
+		returnedUsersAreOrdered().and().
+		noNextCursorIsReturned().and().
+		prevCursorIsReturned()
+}
+
+func TestService_ListsUsers_BeforeCursor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aCursorBefore().and().
+		dbCanListUsersBefore().and().
+		dbCanCountUsers(3)
 
 	when.serviceListsUsers()
 
 	then.noError().and().
 		usersAreReturned().and().
-		returnedUsersAreValid()
+		returnedUsersAreValid().and().
+		returnedUsersAreOrdered().and().
+		nextCursorIsReturned().and().
+		noPrevCursorIsReturned()
+}
+
+func TestService_ListsUsers_EstimatedTotal(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aTotalMode(TotalEstimate).and().
+		dbCanListUsers().and().
+		dbCanEstimateUsers(1000)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		totalIs(1000, true)
+}
+
+func TestService_ListsUsers_EstimatedTotalNotAnalyzed(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aTotalMode(TotalEstimate).and().
+		dbCanListUsers().and().
+		dbCanEstimateUsers(-1).and().
+		dbCanCountUsers(2)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		totalIs(2, false)
+}
+
+func TestService_ListsUsers_NoTotal(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aTotalMode(TotalNone).and().
+		dbCanListUsers()
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		noTotalIsReturned()
+}
+
+func TestService_ListsUsers_Filtered(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aNameFilter("name1").and().
+		aTotalMode(TotalEstimate).and().
+		dbCanListFilteredUsers().and().
+		dbCanCountUsers(1)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		usersAreReturned().and().
+		dbFilterIs(db.UserFilter{Name: "name1"}).and().
+		totalIs(1, false)
+}
+
+func TestService_ListsUsers_AsOf(t *testing.T) {
+	asOf := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	given, when, then := NewBlocks(t)
+	given.anAsOf(asOf).and().
+		aTotalMode(TotalEstimate).and().
+		dbCanListFilteredUsers().and().
+		dbCanCountUsers(1)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		dbFilterIs(db.UserFilter{AsOf: pgtype.Timestamp{Time: asOf, Valid: true}}).and().
+		totalIs(1, false)
+}
+
+func TestService_ListsUsers_InvalidFilter(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aCreatedRange(createdAt, createdAt.Add(-time.Hour))
+
+	when.serviceListsUsers()
+
+	then.returnedErrorIs(ErrInvalidFilter)
+}
+
+func TestService_ListsUsers_Sorted(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aSort("name,-created_at").and().
+		aPageLimit(1).and().
+		dbCanListSortedUsers().and().
+		dbCanCountUsers(2)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		dbSortIs(db.SortKey{Column: db.SortName}, db.SortKey{Column: db.SortCreatedAt, Desc: true}).and().
+		nextCursorIsReturned()
+}
+
+func TestService_ListsUsers_InvalidSort(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aSort("other")
+
+	when.serviceListsUsers()
+
+	then.returnedErrorIs(ErrInvalidSort)
+}
+
+func TestService_ListsUsers_CursorOfOtherSort(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aCursorAfter().and().
+		aSort("-name")
+
+	when.serviceListsUsers()
+
+	then.returnedErrorIs(ErrInvalidPagination)
+}
+
+func TestService_ListsUsers_LastPage(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aSort("-updated_at").and().
+		aLastPageCursor().and().
+		dbCanListLastUsers().and().
+		dbCanCountUsers(9)
+
+	when.serviceListsUsers()
+
+	then.noError().and().
+		returnedUsersAreOrdered().and().
+		noNextCursorIsReturned().and().
+		hasMoreIs(false)
+}
+
+func TestService_ListsUsers_InvalidLimit(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aPageLimit(MaxLimit + 1)
+
+	when.serviceListsUsers()
+
+	then.returnedErrorIs(ErrInvalidPagination)
+}
+
+func TestService_ListsUsers_MalformedCursor(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aMalformedCursor()
+
+	when.serviceListsUsers()
+
+	then.returnedErrorIs(ErrInvalidPagination)
+}
+
+func TestService_SearchUsers(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aSearchQuery("jonh").and().
+		dbCanSearchUsers()
+
+	when.serviceSearchesUsers()
+
+	then.noError().and().
+		searchResultsAreRanked()
+}
+
+func TestService_SearchUsers_EmptyQuery(t *testing.T) {
+	given, when, then := NewBlocks(t)
+	given.aSearchQuery("")
+
+	when.serviceSearchesUsers()
+
+	then.returnedErrorIs(ErrInvalidSearch)
 }
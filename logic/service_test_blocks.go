@@ -2,14 +2,24 @@ package logic
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/logging"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var createdAt = time.Now()
@@ -20,12 +30,45 @@ type Block struct {
 	queries *MockQueries
 	service *Service
 
-	givenID   int64
-	givenUser User
+	givenID           int64
+	givenUser         User
+	givenListParams   ListParams
+	givenSearchParams SearchParams
+	givenPatchType    string
+	givenPatch        string
+	givenPrecondition *Precondition
+	givenUsers        []User
+	givenBulk         BulkUpdate
+	givenExport       ExportParams
+	givenImport       string
+	givenImportParams ImportParams
+	givenActor        string
+	givenAuditParams  AuditParams
+	givenWebhook      Webhook
+	givenDelivery     DeliveryParams
 
 	returnedUser  *User
 	returnedUsers *UsersResponse
+	searchResults *SearchResponse
+	batchResults  []BatchResult
+	bulkResult    *BulkResult
+	bulkParams    db.BulkParams
+	bulkOther     pgtype.Text
+	exportedUsers []*User
+	importReport  *ImportReport
+	auditResponse *AuditResponse
+	auditParams   db.ListAuditParams
+	webhook       *Webhook
+	webhookParams db.CreateWebhookParams
+	deliveries    *DeliveriesResponse
+	delivery      *Delivery
+	asOfParams    db.GetUserAsOfParams
 	returnErr     error
+	updateParams  db.UpdateUserParams
+	listFilter    db.UserFilter
+	countFilter   db.UserFilter
+	listSort      []db.SortKey
+	spans         *tracetest.SpanRecorder
 }
 
 func NewBlocks(t *testing.T) (*Block, *Block, *Block) {
@@ -35,6 +78,12 @@ func NewBlocks(t *testing.T) (*Block, *Block, *Block) {
 		T:       t,
 		queries: queries,
 		service: service,
+		givenListParams: ListParams{
+			Limit: 10,
+		},
+		givenSearchParams: SearchParams{
+			Limit: 10,
+		},
 	}
 	return b, b, b
 }
@@ -64,6 +113,26 @@ func (b *Block) aID() *Block {
 	return b
 }
 
+func (b *Block) aPageLimit(limit int32) *Block {
+	b.givenListParams.Limit = limit
+	return b
+}
+
+func (b *Block) aCursorAfter() *Block {
+	b.givenListParams.Cursor = encodeCursor(cursor{CreatedAt: createdAt, ID: 1})
+	return b
+}
+
+func (b *Block) aCursorBefore() *Block {
+	b.givenListParams.Cursor = encodeCursor(cursor{CreatedAt: createdAt, ID: 3, Before: true})
+	return b
+}
+
+func (b *Block) aMalformedCursor() *Block {
+	b.givenListParams.Cursor = "not a cursor"
+	return b
+}
+
 func (b *Block) dbCanCreateUser() *Block {
 	b.queries.createUser = func(ctx context.Context, params db.CreateUserParams) (db.User, error) {
 		return db.User{
@@ -86,10 +155,101 @@ func (b *Block) dbCannotCreateDuplicatedUser() *Block {
 	return b
 }
 
+func (b *Block) aBatch(names ...string) *Block {
+	b.givenUsers = nil
+	for _, name := range names {
+		b.givenUsers = append(b.givenUsers, User{Name: name, Other: "other"})
+	}
+	return b
+}
+
+func (b *Block) dbCanCreateUsers(taken ...string) *Block {
+	b.queries.createUsers = func(ctx context.Context, params db.CreateUsersParams) ([]db.User, error) {
+		var users []db.User
+		for i, name := range params.Names {
+			if slices.Contains(taken, name) {
+				continue
+			}
+			user := dbUser(int64(len(users) + 1))
+			user.Name = name
+			user.Other = pgtype.Text{String: params.Others[i], Valid: true}
+			users = append(users, user)
+		}
+		return users, nil
+	}
+	return b
+}
+
+func (b *Block) dbCanCopyUsers() *Block {
+	b.queries.copyUsersAtomic = func(ctx context.Context, params []db.CopyUsersParams) ([]db.User, error) {
+		users := make([]db.User, len(params))
+		for i, p := range params {
+			users[i] = dbUser(int64(i + 1))
+			users[i].Name = p.Name
+			users[i].Other = p.Other
+		}
+		return users, nil
+	}
+	return b
+}
+
+func (b *Block) dbCannotCopyUsersWithTakenName(taken string) *Block {
+	b.queries.copyUsersAtomic = func(ctx context.Context, params []db.CopyUsersParams) ([]db.User, error) {
+		return nil, &pgconn.PgError{
+			Code:    "23505",
+			Message: `duplicate key value violates unique constraint "users_name_live"`,
+		}
+	}
+	b.queries.getUsersByNames = func(ctx context.Context, names []string) ([]db.User, error) {
+		user := dbUser(100)
+		user.Name = taken
+		return []db.User{user}, nil
+	}
+	return b
+}
+
+func (b *Block) anImport(params ImportParams, content string) *Block {
+	b.givenImportParams = params
+	b.givenImport = content
+	return b
+}
+
+func (b *Block) dbHasUsersNamed(names ...string) *Block {
+	b.queries.getUsersByNames = func(ctx context.Context, requested []string) ([]db.User, error) {
+		var users []db.User
+		for i, name := range names {
+			if slices.Contains(requested, name) {
+				user := dbUser(int64(100 + i))
+				user.Name = name
+				users = append(users, user)
+			}
+		}
+		return users, nil
+	}
+	return b
+}
+
+// dbCanUpsertUsers updates users with taken names and creates the rest.
+func (b *Block) dbCanUpsertUsers(taken ...string) *Block {
+	b.queries.upsertUsers = func(ctx context.Context, params db.UpsertUsersParams) ([]db.User, error) {
+		users := make([]db.User, len(params.Names))
+		for i, name := range params.Names {
+			users[i] = dbUser(int64(i + 1))
+			users[i].Name = name
+			users[i].Other = pgtype.Text{String: params.Others[i], Valid: true}
+			if slices.Contains(taken, name) {
+				users[i].UpdatedAt = pgtype.Timestamp{Time: updatedAt, Valid: true}
+			}
+		}
+		return users, nil
+	}
+	return b
+}
+
 func (b *Block) dbCanGetUser() *Block {
-	b.queries.getUser = func(ctx context.Context, id int64) (db.User, error) {
+	b.queries.getUser = func(ctx context.Context, params db.GetUserParams) (db.User, error) {
 		return db.User{
-			ID:        id,
+			ID:        params.ID,
 			Name:      "name",
 			Other:     pgtype.Text{String: "other", Valid: true},
 			CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true},
@@ -98,8 +258,136 @@ func (b *Block) dbCanGetUser() *Block {
 	return b
 }
 
+func (b *Block) anActor(actor string) *Block {
+	b.givenActor = actor
+	return b
+}
+
+func (b *Block) anAuditPage(limit int32, cursor string) *Block {
+	b.givenAuditParams.Limit = limit
+	b.givenAuditParams.Cursor = cursor
+	return b
+}
+
+func (b *Block) anAuditAction(action string) *Block {
+	b.givenAuditParams.Filter.Action = action
+	return b
+}
+
+// dbHasAuditEntries returns entries with ids descending from newest, and
+// only those before the requested id.
+func (b *Block) dbHasAuditEntries(newest int64) *Block {
+	b.queries.listAudit = func(ctx context.Context, params db.ListAuditParams) ([]db.AuditLog, error) {
+		b.auditParams = params
+		var rows []db.AuditLog
+		for id := newest; id > 0 && len(rows) < int(params.Limit); id-- {
+			if params.BeforeID != 0 && id >= params.BeforeID {
+				continue
+			}
+			rows = append(rows, db.AuditLog{
+				ID:        id,
+				UserID:    params.Filter.UserID,
+				Action:    db.AuditUpdate,
+				Actor:     "admin",
+				After:     []byte(`{"id": 1}`),
+				CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true},
+			})
+		}
+		return rows, nil
+	}
+	return b
+}
+
+func (b *Block) aWebhook(url, secret string, eventTypes ...string) *Block {
+	b.givenWebhook = Webhook{URL: url, Secret: secret, EventTypes: eventTypes}
+	return b
+}
+
+func (b *Block) aDeliveryPage(limit int32, status string) *Block {
+	b.givenDelivery = DeliveryParams{Limit: limit, Status: status}
+	return b
+}
+
+func (b *Block) dbCanCreateWebhook() *Block {
+	b.queries.createWebhook = func(ctx context.Context, params db.CreateWebhookParams) (db.Webhook, error) {
+		b.webhookParams = params
+		return db.Webhook{
+			ID:         1,
+			Url:        params.Url,
+			EventTypes: params.EventTypes,
+			Secret:     params.Secret,
+			CreatedAt:  pgtype.Timestamp{Time: createdAt, Valid: true},
+		}, nil
+	}
+	return b
+}
+
+func (b *Block) dbCannotFindWebhook() *Block {
+	b.queries.getWebhook = func(ctx context.Context, id int64) (db.Webhook, error) {
+		return db.Webhook{}, pgx.ErrNoRows
+	}
+	return b
+}
+
+// dbHasDeliveries returns deliveries with ids descending from newest, and
+// only those before the requested id.
+func (b *Block) dbHasDeliveries(newest int64) *Block {
+	b.queries.listWebhookDeliveries = func(ctx context.Context, params db.ListWebhookDeliveriesParams) ([]db.ListWebhookDeliveriesRow, error) {
+		var rows []db.ListWebhookDeliveriesRow
+		for id := newest; id > 0 && len(rows) < int(params.RowLimit); id-- {
+			if params.BeforeID.Valid && id >= params.BeforeID.Int64 {
+				continue
+			}
+			rows = append(rows, db.ListWebhookDeliveriesRow{
+				WebhookDelivery: db.WebhookDelivery{
+					ID:        id,
+					WebhookID: params.WebhookID,
+					EventID:   id,
+					Status:    db.DeliveryDead,
+					Attempts:  5,
+					CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true},
+				},
+				EventType: db.EventUserCreated,
+			})
+		}
+		return rows, nil
+	}
+	return b
+}
+
+func (b *Block) dbCannotFindDelivery() *Block {
+	b.queries.redeliverWebhookDelivery = func(ctx context.Context, params db.RedeliverWebhookDeliveryParams) (db.WebhookDelivery, error) {
+		return db.WebhookDelivery{}, pgx.ErrNoRows
+	}
+	return b
+}
+
+func (b *Block) dbHasUserHistory() *Block {
+	b.queries.getUserAsOf = func(ctx context.Context, params db.GetUserAsOfParams) (db.GetUserAsOfRow, error) {
+		b.asOfParams = params
+		return db.GetUserAsOfRow(dbUser(params.ID)), nil
+	}
+	return b
+}
+
+func (b *Block) dbHasNoUserHistory() *Block {
+	b.queries.getUserAsOf = func(ctx context.Context, params db.GetUserAsOfParams) (db.GetUserAsOfRow, error) {
+		return db.GetUserAsOfRow{}, pgx.ErrNoRows
+	}
+	return b
+}
+
+// spansAreRecorded records the spans ended by the service.
+func (b *Block) spansAreRecorded() *Block {
+	previous := otel.GetTracerProvider()
+	b.spans = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(b.spans)))
+	b.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return b
+}
+
 func (b *Block) dbCannotFindUser() *Block {
-	b.queries.getUser = func(ctx context.Context, id int64) (db.User, error) {
+	b.queries.getUser = func(ctx context.Context, params db.GetUserParams) (db.User, error) {
 		return db.User{}, pgx.ErrNoRows
 	}
 	return b
@@ -118,6 +406,27 @@ func (b *Block) dbCanUpdateUser() *Block {
 	return b
 }
 
+func (b *Block) aPatch(patchType, patch string) *Block {
+	b.givenPatchType = patchType
+	b.givenPatch = patch
+	return b
+}
+
+func (b *Block) dbCanPatchUser() *Block {
+	b.dbCanGetUser()
+	b.queries.updateUser = func(ctx context.Context, params db.UpdateUserParams) (db.User, error) {
+		b.updateParams = params
+		return db.User{
+			ID:        params.ID,
+			Name:      params.Name,
+			Other:     params.Other,
+			CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true},
+			UpdatedAt: pgtype.Timestamp{Time: updatedAt, Valid: true},
+		}, nil
+	}
+	return b
+}
+
 func (b *Block) dbCannotUpdateWithExistingUsername() *Block {
 	b.queries.updateUser = func(ctx context.Context, params db.UpdateUserParams) (db.User, error) {
 		return db.User{}, &pgconn.PgError{
@@ -136,15 +445,162 @@ func (b *Block) dbCannotFindUserForUpdate() *Block {
 }
 
 func (b *Block) dbCanDeleteUser() *Block {
-	b.queries.deleteUser = func(ctx context.Context, id int64) error {
-		return nil
+	b.queries.deleteUser = func(ctx context.Context, params db.DeleteUserParams) (int64, error) {
+		return 1, nil
 	}
 	return b
 }
 
 func (b *Block) dbCannotFindUserForDelete() *Block {
-	b.queries.deleteUser = func(ctx context.Context, id int64) error {
-		return pgx.ErrNoRows
+	b.queries.deleteUser = func(ctx context.Context, params db.DeleteUserParams) (int64, error) {
+		return 0, nil
+	}
+	return b
+}
+
+// dbHasDeletedUser has a soft deleted user found only with include deleted.
+func (b *Block) dbHasDeletedUser() *Block {
+	b.queries.getUser = func(ctx context.Context, params db.GetUserParams) (db.User, error) {
+		if !params.IncludeDeleted {
+			return db.User{}, pgx.ErrNoRows
+		}
+		user := dbUser(params.ID)
+		user.DeletedAt = pgtype.Timestamp{Time: updatedAt, Valid: true}
+		return user, nil
+	}
+	b.queries.restoreUser = func(ctx context.Context, id int64) (db.User, error) {
+		return dbUser(id), nil
+	}
+	b.queries.purgeUser = func(ctx context.Context, id int64) (int64, error) {
+		return 1, nil
+	}
+	return b
+}
+
+func (b *Block) dbHasLiveUser() *Block {
+	b.queries.getUser = func(ctx context.Context, params db.GetUserParams) (db.User, error) {
+		return dbUser(params.ID), nil
+	}
+	b.queries.restoreUser = func(ctx context.Context, id int64) (db.User, error) {
+		return db.User{}, pgx.ErrNoRows
+	}
+	b.queries.purgeUser = func(ctx context.Context, id int64) (int64, error) {
+		return 0, nil
+	}
+	return b
+}
+
+func (b *Block) aPrecondition(versions ...int64) *Block {
+	b.givenPrecondition = &Precondition{Versions: versions}
+	return b
+}
+
+func (b *Block) serviceRequiresPrecondition() *Block {
+	b.service = NewService(b.queries, WithRequiredPrecondition())
+	return b
+}
+
+func (b *Block) serviceAllowsBulkRows(maxRows int32) *Block {
+	b.service = NewService(b.queries, WithBulkMaxRows(maxRows))
+	return b
+}
+
+func (b *Block) serviceRejectsWebhookURLs() *Block {
+	b.service = NewService(b.queries, WithWebhookURLCheck(func(context.Context, string) error {
+		return errors.New("address not allowed")
+	}))
+	return b
+}
+
+func (b *Block) aBulkByIDs(ids ...int64) *Block {
+	b.givenBulk.IDs = ids
+	return b
+}
+
+func (b *Block) aBulkByFilter(filter Filter) *Block {
+	b.givenBulk.Filter = &filter
+	return b
+}
+
+func (b *Block) aBulkOther(raw string) *Block {
+	b.givenBulk.Other = json.RawMessage(raw)
+	return b
+}
+
+func (b *Block) aDryRun() *Block {
+	b.givenBulk.DryRun = true
+	return b
+}
+
+// dbCanBulkChangeUsers selects users with ids for any bulk change.
+func (b *Block) dbCanBulkChangeUsers(ids ...int64) *Block {
+	b.queries.bulkSetUsersOther = func(ctx context.Context, params db.BulkParams, other pgtype.Text) ([]int64, error) {
+		b.bulkParams = params
+		b.bulkOther = other
+		return ids, nil
+	}
+	b.queries.bulkDeleteUsers = func(ctx context.Context, params db.BulkParams) ([]int64, error) {
+		b.bulkParams = params
+		return ids, nil
+	}
+	return b
+}
+
+// dbCountsBulkUsers counts total users selected by a dry run.
+func (b *Block) dbCountsBulkUsers(total int64) *Block {
+	b.queries.countBulkUsers = func(ctx context.Context, params db.BulkParams) (int64, error) {
+		return total, nil
+	}
+	return b
+}
+
+func (b *Block) dbSelectsTooManyUsers() *Block {
+	b.queries.bulkDeleteUsers = func(ctx context.Context, params db.BulkParams) ([]int64, error) {
+		return nil, db.ErrTooManyRows
+	}
+	return b
+}
+
+func (b *Block) anExportOf(columns ...string) *Block {
+	b.givenExport.Columns = columns
+	return b
+}
+
+// dbCanExportUsers streams count users in id order.
+func (b *Block) dbCanExportUsers(count int) *Block {
+	b.queries.exportUsers = func(ctx context.Context, filter db.UserFilter, fn func(db.User) error) error {
+		for i := range count {
+			if err := fn(dbUser(int64(i + 1))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return b
+}
+
+// dbHasUserVersion makes conditioned writes fail unless they expect version.
+func (b *Block) dbHasUserVersion(version int64) *Block {
+	b.queries.getUser = func(ctx context.Context, params db.GetUserParams) (db.User, error) {
+		user := dbUser(params.ID)
+		user.Version = version
+		return user, nil
+	}
+	b.queries.updateUser = func(ctx context.Context, params db.UpdateUserParams) (db.User, error) {
+		if params.Versions != nil && !slices.Contains(params.Versions, version) {
+			return db.User{}, pgx.ErrNoRows
+		}
+		user := dbUser(params.ID)
+		user.Name = params.Name
+		user.Other = params.Other
+		user.Version = version + 1
+		return user, nil
+	}
+	b.queries.deleteUser = func(ctx context.Context, params db.DeleteUserParams) (int64, error) {
+		if params.Versions != nil && !slices.Contains(params.Versions, version) {
+			return 0, nil
+		}
+		return 1, nil
 	}
 	return b
 }
@@ -169,29 +625,237 @@ func (b *Block) dbCanListUsers() *Block {
 	return b
 }
 
+func (b *Block) dbCanListUsersAfter() *Block {
+	b.queries.listUsers = func(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+		if params.Key == nil || params.Backward {
+			b.Fatal("users listed without after key")
+		}
+		return []db.User{dbUser(params.Key.ID + 1), dbUser(params.Key.ID + 2)}, nil
+	}
+	return b
+}
+
+func (b *Block) dbCanListUsersBefore() *Block {
+	b.queries.listUsers = func(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+		if params.Key == nil || !params.Backward {
+			b.Fatal("users listed without before key")
+		}
+		return []db.User{dbUser(params.Key.ID - 1), dbUser(params.Key.ID - 2)}, nil
+	}
+	return b
+}
+
+func (b *Block) aNameFilter(name string) *Block {
+	b.givenListParams.Filter.Name = name
+	return b
+}
+
+func (b *Block) anAsOf(asOf time.Time) *Block {
+	b.givenListParams.Filter.AsOf = &asOf
+	return b
+}
+
+func (b *Block) aCreatedRange(after, before time.Time) *Block {
+	b.givenListParams.Filter.CreatedAfter = &after
+	b.givenListParams.Filter.CreatedBefore = &before
+	return b
+}
+
+func (b *Block) aSort(sort string) *Block {
+	b.givenListParams.Sort = sort
+	return b
+}
+
+func (b *Block) aLastPageCursor() *Block {
+	b.givenListParams.Cursor = LastPageCursor(b.givenListParams.Sort)
+	return b
+}
+
+func (b *Block) dbCanListLastUsers() *Block {
+	b.queries.listUsers = func(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+		if params.Key != nil || !params.Backward {
+			b.Fatal("last users listed with a key")
+		}
+		return []db.User{dbUser(9), dbUser(8)}, nil
+	}
+	return b
+}
+
+func (b *Block) dbCanListSortedUsers() *Block {
+	b.queries.listUsers = func(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+		b.listSort = params.Sort
+		return []db.User{dbUser(1), dbUser(2)}, nil
+	}
+	return b
+}
+
+func (b *Block) dbCanListFilteredUsers() *Block {
+	b.queries.listUsers = func(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+		b.listFilter = params.Filter
+		return []db.User{dbUser(1)}, nil
+	}
+	return b
+}
+
+func (b *Block) aTotalMode(mode string) *Block {
+	b.givenListParams.Total = mode
+	return b
+}
+
+func (b *Block) dbCanCountUsers(total int64) *Block {
+	b.queries.countUsers = func(ctx context.Context, filter db.UserFilter) (int64, error) {
+		b.countFilter = filter
+		return total, nil
+	}
+	return b
+}
+
+func (b *Block) dbCanEstimateUsers(estimate int64) *Block {
+	b.queries.estimateUsers = func(ctx context.Context) (int64, error) {
+		return estimate, nil
+	}
+	return b
+}
+
+func (b *Block) aSearchQuery(query string) *Block {
+	b.givenSearchParams.Query = query
+	return b
+}
+
+func (b *Block) dbCanSearchUsers() *Block {
+	b.queries.searchUsers = func(ctx context.Context, params db.SearchUsersParams) ([]db.SearchUsersRow, error) {
+		return []db.SearchUsersRow{
+			{ID: 1, Name: params.Query, CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true}, Score: 1},
+			{ID: 2, Name: params.Query + "x", CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true}, Score: 0.5},
+		}, nil
+	}
+	return b
+}
+
 func (b *Block) serviceCreatesUser() *Block {
-	b.returnedUser, b.returnErr = b.service.CreateUser(context.Background(), b.givenUser)
+	b.returnedUser, b.returnErr = b.service.CreateUser(b.requestContext(), b.givenUser)
+	return b
+}
+
+// requestContext carries the given actor and a request id like a request.
+func (b *Block) requestContext() context.Context {
+	ctx := logging.WithRequestID(context.Background(), "request-1")
+	if b.givenActor != "" {
+		ctx = logging.WithActor(ctx, b.givenActor)
+	}
+	return ctx
+}
+
+func (b *Block) serviceListsAudit() *Block {
+	b.auditResponse, b.returnErr = b.service.ListAudit(context.Background(), b.givenAuditParams)
+	return b
+}
+
+func (b *Block) serviceGetsUserHistory() *Block {
+	b.auditResponse, b.returnErr = b.service.GetUserHistory(context.Background(), b.givenID, b.givenAuditParams)
+	return b
+}
+
+func (b *Block) serviceCreatesWebhook() *Block {
+	b.webhook, b.returnErr = b.service.CreateWebhook(context.Background(), b.givenWebhook)
+	return b
+}
+
+func (b *Block) serviceListsDeliveries() *Block {
+	b.deliveries, b.returnErr = b.service.ListDeliveries(context.Background(), b.givenID, b.givenDelivery)
+	return b
+}
+
+func (b *Block) serviceRedelivers() *Block {
+	b.delivery, b.returnErr = b.service.Redeliver(context.Background(), b.givenID, 1)
+	return b
+}
+
+func (b *Block) serviceCreatesUsers(atomic bool) *Block {
+	b.batchResults, b.returnErr = b.service.CreateUsers(b.requestContext(), b.givenUsers, atomic)
+	return b
+}
+
+func (b *Block) serviceImportsUsers() *Block {
+	b.importReport, b.returnErr = b.service.ImportUsers(b.requestContext(), strings.NewReader(b.givenImport), b.givenImportParams)
+	return b
+}
+
+func (b *Block) serviceBulkUpdatesUsers() *Block {
+	b.bulkResult, b.returnErr = b.service.BulkUpdateUsers(b.requestContext(), b.givenBulk)
+	return b
+}
+
+func (b *Block) serviceBulkDeletesUsers() *Block {
+	b.bulkResult, b.returnErr = b.service.BulkDeleteUsers(b.requestContext(), b.givenBulk.BulkSelector)
+	return b
+}
+
+func (b *Block) serviceExportsUsers() *Block {
+	b.returnErr = b.service.ExportUsers(context.Background(), b.givenExport, func(user *User) error {
+		b.exportedUsers = append(b.exportedUsers, user)
+		return nil
+	})
+	return b
+}
+
+// serviceExportsUsersUntil stops the export with err after the first user.
+func (b *Block) serviceExportsUsersUntil(err error) *Block {
+	b.returnErr = b.service.ExportUsers(context.Background(), b.givenExport, func(user *User) error {
+		b.exportedUsers = append(b.exportedUsers, user)
+		return err
+	})
 	return b
 }
 
 func (b *Block) serviceGetsUser() *Block {
-	b.returnedUser, b.returnErr = b.service.GetUserByID(context.Background(), b.givenID)
+	b.returnedUser, b.returnErr = b.service.GetUserByID(context.Background(), b.givenID, false)
+	return b
+}
+
+func (b *Block) serviceGetsUserAsOf(asOf time.Time) *Block {
+	b.returnedUser, b.returnErr = b.service.GetUserAsOf(context.Background(), b.givenID, asOf, false)
+	return b
+}
+
+func (b *Block) serviceGetsUserIncludingDeleted() *Block {
+	b.returnedUser, b.returnErr = b.service.GetUserByID(context.Background(), b.givenID, true)
+	return b
+}
+
+func (b *Block) serviceRestoresUser() *Block {
+	b.returnedUser, b.returnErr = b.service.RestoreUserByID(b.requestContext(), b.givenID)
+	return b
+}
+
+func (b *Block) servicePurgesUser() *Block {
+	b.returnErr = b.service.PurgeUserByID(b.requestContext(), b.givenID)
 	return b
 }
 
 func (b *Block) serviceUpdatesUser() *Block {
-	b.returnedUser, b.returnErr = b.service.UpdateUserByID(context.Background(), b.givenID, b.givenUser)
+	b.returnedUser, b.returnErr = b.service.UpdateUserByID(context.Background(), b.givenID, b.givenUser, b.givenPrecondition)
+	return b
+}
+
+func (b *Block) servicePatchesUser() *Block {
+	b.returnedUser, b.returnErr = b.service.PatchUserByID(context.Background(), b.givenID, b.givenPatchType, []byte(b.givenPatch), b.givenPrecondition)
 	return b
 }
 
 func (b *Block) serviceDeletesUser() *Block {
-	err := b.service.DeleteUserByID(context.Background(), b.givenID)
+	err := b.service.DeleteUserByID(b.requestContext(), b.givenID, b.givenPrecondition)
 	b.returnErr = err
 	return b
 }
 
 func (b *Block) serviceListsUsers() *Block {
-	b.returnedUsers, b.returnErr = b.service.ListUsers(context.Background(), 10, 0)
+	b.returnedUsers, b.returnErr = b.service.ListUsers(context.Background(), b.givenListParams)
+	return b
+}
+
+func (b *Block) serviceSearchesUsers() *Block {
+	b.searchResults, b.returnErr = b.service.SearchUsers(context.Background(), b.givenSearchParams)
 	return b
 }
 
@@ -202,6 +866,20 @@ func (b *Block) noError() *Block {
 	return b
 }
 
+func (b *Block) spanFailed(name string) *Block {
+	for _, span := range b.spans.Ended() {
+		if span.Name() != name {
+			continue
+		}
+		if span.Status().Code != codes.Error || len(span.Events()) == 0 {
+			b.Fatalf("span %s not failed: %+v", name, span.Status())
+		}
+		return b
+	}
+	b.Fatalf("span %s not ended", name)
+	return b
+}
+
 func (b *Block) returnedErrorIs(err error) *Block {
 	if b.returnErr == nil {
 		b.Fatal("error not returned")
@@ -212,6 +890,135 @@ func (b *Block) returnedErrorIs(err error) *Block {
 	return b
 }
 
+func (b *Block) exportedUsersAre(ids ...int64) *Block {
+	if len(b.exportedUsers) != len(ids) {
+		b.Fatalf("exported users not expected: %d", len(b.exportedUsers))
+	}
+	for i, id := range ids {
+		if b.exportedUsers[i].ID != id {
+			b.Fatalf("exported user %d not expected: %v", i, b.exportedUsers[i].ID)
+		}
+	}
+	return b
+}
+
+func (b *Block) auditIs(actor, requestID string) *Block {
+	expected := []db.Audit{{Actor: actor, RequestID: requestID}}
+	if !reflect.DeepEqual(b.queries.audits, expected) {
+		b.Fatalf("audit not expected: %+v", b.queries.audits)
+	}
+	return b
+}
+
+func (b *Block) auditEntriesAre(ids ...int64) *Block {
+	if b.auditResponse == nil || b.auditResponse.Count != len(ids) {
+		b.Fatalf("audit entries not expected: %+v", b.auditResponse)
+	}
+	for i, id := range ids {
+		if b.auditResponse.Entries[i].ID != id {
+			b.Fatalf("audit entry %d not expected: %v", i, b.auditResponse.Entries[i].ID)
+		}
+	}
+	return b
+}
+
+// webhookIsReturned checks the stored event types and that the secret is
+// stored but not returned.
+func (b *Block) webhookIsReturned(eventTypes ...string) *Block {
+	if b.webhook == nil || b.webhook.Secret != "" || b.webhookParams.Secret != b.givenWebhook.Secret {
+		b.Fatalf("webhook not expected: %+v", b.webhook)
+	}
+	if !slices.Equal(b.webhookParams.EventTypes, eventTypes) || !slices.Equal(b.webhook.EventTypes, eventTypes) {
+		b.Fatalf("event types not expected: %v", b.webhookParams.EventTypes)
+	}
+	return b
+}
+
+func (b *Block) deliveriesAre(ids ...int64) *Block {
+	if b.deliveries == nil || b.deliveries.Count != len(ids) {
+		b.Fatalf("deliveries not expected: %+v", b.deliveries)
+	}
+	for i, id := range ids {
+		if b.deliveries.Deliveries[i].ID != id {
+			b.Fatalf("delivery %d not expected: %v", i, b.deliveries.Deliveries[i].ID)
+		}
+	}
+	return b
+}
+
+// nextDeliveryPageIsRequested follows next_cursor of the returned page.
+func (b *Block) nextDeliveryPageIsRequested() *Block {
+	if b.deliveries.NextCursor == "" {
+		b.Fatal("next cursor not returned")
+	}
+	b.givenDelivery.Cursor = b.deliveries.NextCursor
+	return b.serviceListsDeliveries()
+}
+
+// nextAuditPageIsRequested follows next_cursor of the returned page.
+func (b *Block) nextAuditPageIsRequested() *Block {
+	if b.auditResponse.NextCursor == "" {
+		b.Fatal("next cursor not returned")
+	}
+	b.givenAuditParams.Cursor = b.auditResponse.NextCursor
+	return b.serviceListsAudit()
+}
+
+func (b *Block) importReportIs(expected ImportReport) *Block {
+	if b.importReport == nil || !reflect.DeepEqual(*b.importReport, expected) {
+		b.Fatalf("import report not expected: %+v", b.importReport)
+	}
+	return b
+}
+
+func (b *Block) bulkResultIs(dryRun bool, ids ...int64) *Block {
+	return b.bulkResultCounts(dryRun, len(ids), false, ids...)
+}
+
+func (b *Block) bulkResultCounts(dryRun bool, count int, wouldExceedLimit bool, ids ...int64) *Block {
+	if b.bulkResult == nil || !slices.Equal(b.bulkResult.IDs, ids) || b.bulkResult.Count != count {
+		b.Fatalf("bulk result not expected: %+v", b.bulkResult)
+	}
+	if b.bulkResult.WouldExceedLimit != wouldExceedLimit {
+		b.Fatalf("would exceed limit not expected: %v", b.bulkResult.WouldExceedLimit)
+	}
+	if b.bulkResult.DryRun != dryRun || b.bulkParams.DryRun != dryRun {
+		b.Fatalf("dry run not expected: %v", b.bulkResult.DryRun)
+	}
+	return b
+}
+
+func (b *Block) dbBulkOtherIs(expected pgtype.Text) *Block {
+	if b.bulkOther != expected {
+		b.Fatalf("db other not expected: %+v", b.bulkOther)
+	}
+	return b
+}
+
+func (b *Block) dbBulkFilterIs(expected db.UserFilter) *Block {
+	if b.bulkParams.IDs != nil || !reflect.DeepEqual(b.bulkParams.Filter, expected) {
+		b.Fatalf("db bulk params not expected: %+v", b.bulkParams)
+	}
+	return b
+}
+
+// batchResultsAre checks the error of each item, nil for a created user.
+func (b *Block) batchResultsAre(errs ...error) *Block {
+	if len(b.batchResults) != len(errs) {
+		b.Fatalf("batch results not expected: %d", len(b.batchResults))
+	}
+	for i, err := range errs {
+		result := b.batchResults[i]
+		if err == nil && (result.User == nil || result.User.Name != b.givenUsers[i].Name) {
+			b.Fatalf("user %d not created: %v", i, result.Err)
+		}
+		if err != nil && (result.User != nil || !errors.Is(result.Err, err)) {
+			b.Fatalf("user %d error not expected: %v", i, result.Err)
+		}
+	}
+	return b
+}
+
 func (b *Block) userIsReturned() *Block {
 	if b.returnedUser == nil {
 		b.Fatal("user not returned")
@@ -219,6 +1026,40 @@ func (b *Block) userIsReturned() *Block {
 	return b
 }
 
+func (b *Block) userIsUpdatedTo(name string, other *string) *Block {
+	if b.updateParams.Name != name {
+		b.Fatalf("name not expected: %v", b.updateParams.Name)
+	}
+	if other == nil && b.updateParams.Other.Valid {
+		b.Fatalf("other not cleared: %v", b.updateParams.Other.String)
+	}
+	if other != nil && (!b.updateParams.Other.Valid || b.updateParams.Other.String != *other) {
+		b.Fatalf("other not expected: %v", b.updateParams.Other)
+	}
+	return b
+}
+
+func (b *Block) returnedUserIsDeleted() *Block {
+	if b.returnedUser.DeletedAt == nil {
+		b.Fatal("user not deleted")
+	}
+	return b
+}
+
+func (b *Block) returnedUserIsLive() *Block {
+	if b.returnedUser.DeletedAt != nil {
+		b.Fatal("user deleted")
+	}
+	return b
+}
+
+func (b *Block) returnedVersionIs(version int64) *Block {
+	if b.returnedUser.Version != version {
+		b.Fatalf("version not expected: %v", b.returnedUser.Version)
+	}
+	return b
+}
+
 func (b *Block) returnedUserIsValid() *Block {
 	return b.userIsValid(b.returnedUser)
 }
@@ -240,6 +1081,104 @@ func (b *Block) userIsValid(user *User) *Block {
 	return b
 }
 
+func (b *Block) returnedUsersAreOrdered() *Block {
+	for i := 1; i < len(b.returnedUsers.Users); i++ {
+		if b.returnedUsers.Users[i-1].ID > b.returnedUsers.Users[i].ID {
+			b.Fatal("users not ordered")
+		}
+	}
+	return b
+}
+
+func (b *Block) totalIs(total int64, estimated bool) *Block {
+	if b.returnedUsers.Total == nil || *b.returnedUsers.Total != total {
+		b.Fatalf("total not expected: %v", b.returnedUsers.Total)
+	}
+	if b.returnedUsers.TotalEstimated != estimated {
+		b.Fatalf("total estimated not expected: %v", b.returnedUsers.TotalEstimated)
+	}
+	return b
+}
+
+func (b *Block) noTotalIsReturned() *Block {
+	if b.returnedUsers.Total != nil {
+		b.Fatal("total returned")
+	}
+	return b
+}
+
+func (b *Block) hasMoreIs(hasMore bool) *Block {
+	if b.returnedUsers.HasMore != hasMore {
+		b.Fatalf("has more not expected: %v", b.returnedUsers.HasMore)
+	}
+	return b
+}
+
+func (b *Block) dbAsOfIs(expected time.Time) *Block {
+	if b.asOfParams.AsOf != (pgtype.Timestamp{Time: expected, Valid: true}) {
+		b.Fatalf("db as of not expected: %+v", b.asOfParams.AsOf)
+	}
+	return b
+}
+
+func (b *Block) dbFilterIs(expected db.UserFilter) *Block {
+	if b.listFilter != expected {
+		b.Fatalf("list filter not expected: %+v", b.listFilter)
+	}
+	if b.countFilter != expected {
+		b.Fatalf("count filter not expected: %+v", b.countFilter)
+	}
+	return b
+}
+
+func (b *Block) dbSortIs(expected ...db.SortKey) *Block {
+	if !slices.Equal(b.listSort, expected) {
+		b.Fatalf("sort not expected: %+v", b.listSort)
+	}
+	return b
+}
+
+func (b *Block) searchResultsAreRanked() *Block {
+	if b.searchResults == nil || b.searchResults.Count != len(b.searchResults.Users) || b.searchResults.Count == 0 {
+		b.Fatal("search results not returned")
+	}
+	for i, user := range b.searchResults.Users {
+		b.userIsValid(user.User)
+		if i > 0 && b.searchResults.Users[i-1].Score < user.Score {
+			b.Fatal("search results not ranked")
+		}
+	}
+	return b
+}
+
+func (b *Block) nextCursorIsReturned() *Block {
+	if b.returnedUsers.NextCursor == "" {
+		b.Fatal("next cursor not returned")
+	}
+	return b
+}
+
+func (b *Block) noNextCursorIsReturned() *Block {
+	if b.returnedUsers.NextCursor != "" {
+		b.Fatal("next cursor returned")
+	}
+	return b
+}
+
+func (b *Block) prevCursorIsReturned() *Block {
+	if b.returnedUsers.PrevCursor == "" {
+		b.Fatal("prev cursor not returned")
+	}
+	return b
+}
+
+func (b *Block) noPrevCursorIsReturned() *Block {
+	if b.returnedUsers.PrevCursor != "" {
+		b.Fatal("prev cursor returned")
+	}
+	return b
+}
+
 func (b *Block) usersAreReturned() *Block {
 	if b.returnedUsers == nil || len(b.returnedUsers.Users) == 0 {
 		b.Fatal("users not returned")
@@ -247,30 +1186,162 @@ func (b *Block) usersAreReturned() *Block {
 	return b
 }
 
+func dbUser(id int64) db.User {
+	return db.User{
+		ID:        id,
+		Name:      fmt.Sprintf("name%d", id),
+		Other:     pgtype.Text{String: "other", Valid: true},
+		CreatedAt: pgtype.Timestamp{Time: createdAt, Valid: true},
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
 type MockQueries struct {
-	createUser func(context.Context, db.CreateUserParams) (db.User, error)
-	getUser    func(context.Context, int64) (db.User, error)
-	updateUser func(context.Context, db.UpdateUserParams) (db.User, error)
-	deleteUser func(context.Context, int64) error
-	listUsers  func(context.Context, db.ListUsersParams) ([]db.User, error)
+	createUser      func(context.Context, db.CreateUserParams) (db.User, error)
+	createUsers     func(context.Context, db.CreateUsersParams) ([]db.User, error)
+	copyUsersAtomic func(context.Context, []db.CopyUsersParams) ([]db.User, error)
+	getUsersByNames func(context.Context, []string) ([]db.User, error)
+	upsertUsers     func(context.Context, db.UpsertUsersParams) ([]db.User, error)
+	getUser         func(context.Context, db.GetUserParams) (db.User, error)
+	getUserAsOf     func(context.Context, db.GetUserAsOfParams) (db.GetUserAsOfRow, error)
+	updateUser      func(context.Context, db.UpdateUserParams) (db.User, error)
+	deleteUser      func(context.Context, db.DeleteUserParams) (int64, error)
+	listUsers       func(context.Context, db.ListUsersParams) ([]db.User, error)
+	countUsers      func(context.Context, db.UserFilter) (int64, error)
+	searchUsers     func(context.Context, db.SearchUsersParams) ([]db.SearchUsersRow, error)
+	estimateUsers   func(context.Context) (int64, error)
+	restoreUser     func(context.Context, int64) (db.User, error)
+	purgeUser       func(context.Context, int64) (int64, error)
+
+	bulkSetUsersOther func(context.Context, db.BulkParams, pgtype.Text) ([]int64, error)
+	bulkDeleteUsers   func(context.Context, db.BulkParams) ([]int64, error)
+	countBulkUsers    func(context.Context, db.BulkParams) (int64, error)
+	exportUsers       func(context.Context, db.UserFilter, func(db.User) error) error
+	listAudit         func(context.Context, db.ListAuditParams) ([]db.AuditLog, error)
+
+	createWebhook            func(context.Context, db.CreateWebhookParams) (db.Webhook, error)
+	getWebhook               func(context.Context, int64) (db.Webhook, error)
+	listWebhooks             func(context.Context) ([]db.Webhook, error)
+	deleteWebhook            func(context.Context, int64) (int64, error)
+	listWebhookDeliveries    func(context.Context, db.ListWebhookDeliveriesParams) ([]db.ListWebhookDeliveriesRow, error)
+	redeliverWebhookDelivery func(context.Context, db.RedeliverWebhookDeliveryParams) (db.WebhookDelivery, error)
+
+	audits []db.Audit
 }
 
-func (m *MockQueries) CreateUser(ctx context.Context, params db.CreateUserParams) (db.User, error) {
+func (m *MockQueries) CreateUserAudited(ctx context.Context, params db.CreateUserParams, audit db.Audit) (db.User, error) {
+	m.audits = append(m.audits, audit)
 	return m.createUser(ctx, params)
 }
 
-func (m *MockQueries) GetUser(ctx context.Context, id int64) (db.User, error) {
-	return m.getUser(ctx, id)
+func (m *MockQueries) CreateUsersAudited(ctx context.Context, params db.CreateUsersParams, audit db.Audit) ([]db.User, error) {
+	m.audits = append(m.audits, audit)
+	return m.createUsers(ctx, params)
+}
+
+func (m *MockQueries) CopyUsersAtomic(ctx context.Context, params []db.CopyUsersParams, audit db.Audit) ([]db.User, error) {
+	m.audits = append(m.audits, audit)
+	return m.copyUsersAtomic(ctx, params)
+}
+
+func (m *MockQueries) GetUsersByNames(ctx context.Context, names []string) ([]db.User, error) {
+	return m.getUsersByNames(ctx, names)
+}
+
+func (m *MockQueries) UpsertUsersAudited(ctx context.Context, params db.UpsertUsersParams, audit db.Audit) ([]db.User, error) {
+	m.audits = append(m.audits, audit)
+	return m.upsertUsers(ctx, params)
+}
+
+func (m *MockQueries) BulkSetUsersOther(ctx context.Context, params db.BulkParams, other pgtype.Text, audit db.Audit) ([]int64, error) {
+	m.audits = append(m.audits, audit)
+	return m.bulkSetUsersOther(ctx, params, other)
+}
+
+func (m *MockQueries) BulkDeleteUsers(ctx context.Context, params db.BulkParams, audit db.Audit) ([]int64, error) {
+	m.audits = append(m.audits, audit)
+	return m.bulkDeleteUsers(ctx, params)
+}
+
+func (m *MockQueries) CountBulkUsers(ctx context.Context, params db.BulkParams) (int64, error) {
+	return m.countBulkUsers(ctx, params)
 }
 
-func (m *MockQueries) UpdateUser(ctx context.Context, params db.UpdateUserParams) (db.User, error) {
+func (m *MockQueries) ExportUsers(ctx context.Context, filter db.UserFilter, fn func(db.User) error) error {
+	return m.exportUsers(ctx, filter, fn)
+}
+
+func (m *MockQueries) ListAudit(ctx context.Context, params db.ListAuditParams) ([]db.AuditLog, error) {
+	return m.listAudit(ctx, params)
+}
+
+func (m *MockQueries) GetUserAsOf(ctx context.Context, params db.GetUserAsOfParams) (db.GetUserAsOfRow, error) {
+	return m.getUserAsOf(ctx, params)
+}
+
+func (m *MockQueries) GetUser(ctx context.Context, params db.GetUserParams) (db.User, error) {
+	return m.getUser(ctx, params)
+}
+
+func (m *MockQueries) UpdateUserAudited(ctx context.Context, params db.UpdateUserParams, audit db.Audit) (db.User, error) {
+	m.audits = append(m.audits, audit)
 	return m.updateUser(ctx, params)
 }
 
-func (m *MockQueries) DeleteUser(ctx context.Context, id int64) error {
-	return m.deleteUser(ctx, id)
+func (m *MockQueries) DeleteUserAudited(ctx context.Context, params db.DeleteUserParams, audit db.Audit) (int64, error) {
+	m.audits = append(m.audits, audit)
+	return m.deleteUser(ctx, params)
 }
 
 func (m *MockQueries) ListUsers(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
 	return m.listUsers(ctx, params)
 }
+
+func (m *MockQueries) CountUsers(ctx context.Context, filter db.UserFilter) (int64, error) {
+	return m.countUsers(ctx, filter)
+}
+
+func (m *MockQueries) EstimateUsersCount(ctx context.Context) (int64, error) {
+	return m.estimateUsers(ctx)
+}
+
+func (m *MockQueries) SearchUsers(ctx context.Context, params db.SearchUsersParams) ([]db.SearchUsersRow, error) {
+	return m.searchUsers(ctx, params)
+}
+
+func (m *MockQueries) RestoreUserAudited(ctx context.Context, id int64, audit db.Audit) (db.User, error) {
+	m.audits = append(m.audits, audit)
+	return m.restoreUser(ctx, id)
+}
+
+func (m *MockQueries) PurgeUserAudited(ctx context.Context, id int64, audit db.Audit) (int64, error) {
+	m.audits = append(m.audits, audit)
+	return m.purgeUser(ctx, id)
+}
+
+func (m *MockQueries) CreateWebhook(ctx context.Context, params db.CreateWebhookParams) (db.Webhook, error) {
+	return m.createWebhook(ctx, params)
+}
+
+func (m *MockQueries) GetWebhook(ctx context.Context, id int64) (db.Webhook, error) {
+	return m.getWebhook(ctx, id)
+}
+
+func (m *MockQueries) ListWebhooks(ctx context.Context) ([]db.Webhook, error) {
+	return m.listWebhooks(ctx)
+}
+
+func (m *MockQueries) DeleteWebhook(ctx context.Context, id int64) (int64, error) {
+	return m.deleteWebhook(ctx, id)
+}
+
+func (m *MockQueries) ListWebhookDeliveries(ctx context.Context, params db.ListWebhookDeliveriesParams) ([]db.ListWebhookDeliveriesRow, error) {
+	return m.listWebhookDeliveries(ctx, params)
+}
+
+func (m *MockQueries) RedeliverWebhookDelivery(ctx context.Context, params db.RedeliverWebhookDeliveryParams) (db.WebhookDelivery, error) {
+	return m.redeliverWebhookDelivery(ctx, params)
+}
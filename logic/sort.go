@@ -0,0 +1,45 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+var sortColumns = []string{db.SortID, db.SortName, db.SortCreatedAt, db.SortUpdatedAt}
+
+// parseSort parses comma separated sort columns, each optionally prefixed
+// with "-" for descending order, e.g. "name,-created_at".
+func parseSort(s string) ([]db.SortKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var keys []db.SortKey
+	for _, field := range strings.Split(s, ",") {
+		column, desc := strings.CutPrefix(strings.TrimSpace(field), "-")
+		if !slices.Contains(sortColumns, column) {
+			return nil, fmt.Errorf("%w: column %q must be one of %s", ErrInvalidSort, column, strings.Join(sortColumns, ", "))
+		}
+		if slices.ContainsFunc(keys, func(k db.SortKey) bool { return k.Column == column }) {
+			return nil, fmt.Errorf("%w: column %q repeated", ErrInvalidSort, column)
+		}
+		keys = append(keys, db.SortKey{Column: column, Desc: desc})
+	}
+	return keys, nil
+}
+
+func formatSort(keys []db.SortKey) string {
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = k.Column
+		if k.Desc {
+			fields[i] = "-" + k.Column
+		}
+	}
+	return strings.Join(fields, ",")
+}
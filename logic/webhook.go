@@ -0,0 +1,253 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MinWebhookSecret is the shortest secret a webhook is signed with.
+const MinWebhookSecret = 16
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+var ErrDeliveryNotFound = errors.New("delivery not found")
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+var eventTypes = []string{db.EventUserCreated, db.EventUserUpdated, db.EventUserDeleted, db.EventUserRestored, db.EventUserPurged}
+
+var deliveryStatuses = []string{db.DeliveryPending, db.DeliveryDelivered, db.DeliveryDead}
+
+// Webhook subscribes a URL to user events, all of them when EventTypes is
+// empty. Secret keys the signature of deliveries and is never returned.
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []*Webhook `json:"webhooks"`
+	Count    int        `json:"count"`
+}
+
+// Delivery is the delivery of an event to a webhook with its last attempt.
+// NextAttemptAt is set while it is pending.
+type Delivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type,omitempty"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	LastStatusCode *int32     `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+type DeliveriesResponse struct {
+	Deliveries []*Delivery `json:"deliveries"`
+	Count      int         `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// DeliveryParams selects a page of deliveries, newest first, optionally
+// only those with Status.
+type DeliveryParams struct {
+	Status string
+	Limit  int32
+	Cursor string
+}
+
+func validateWebhook(webhook *Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https url", ErrInvalidWebhook)
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !slices.Contains(eventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	if len(webhook.Secret) < MinWebhookSecret {
+		return fmt.Errorf("%w: secret must have at least %d characters", ErrInvalidWebhook, MinWebhookSecret)
+	}
+	slices.Sort(webhook.EventTypes)
+	webhook.EventTypes = slices.Compact(webhook.EventTypes)
+	return nil
+}
+
+// CreateWebhook subscribes a webhook to events written from now on.
+func (s *Service) CreateWebhook(ctx context.Context, webhook Webhook) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateWebhook")
+	defer func() { endSpan(span, err) }()
+	if err := validateWebhook(&webhook); err != nil {
+		return nil, err
+	}
+	if s.checkWebhookURL != nil {
+		if err := s.checkWebhookURL(ctx, webhook.URL); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+		}
+	}
+	if webhook.EventTypes == nil {
+		webhook.EventTypes = []string{}
+	}
+	row, err := s.userRepo.CreateWebhook(ctx, db.CreateWebhookParams{
+		Url:        webhook.URL,
+		EventTypes: webhook.EventTypes,
+		Secret:     webhook.Secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromDBWebhook(row), nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, id int64) (_ *Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetWebhook", trace.WithAttributes(attribute.Int64("webhook.id", id)))
+	defer func() { endSpan(span, err) }()
+	row, err := s.userRepo.GetWebhook(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromDBWebhook(row), nil
+}
+
+func (s *Service) ListWebhooks(ctx context.Context) (_ *WebhooksResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListWebhooks")
+	defer func() { endSpan(span, err) }()
+	rows, err := s.userRepo.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &WebhooksResponse{Webhooks: make([]*Webhook, len(rows)), Count: len(rows)}
+	for i, row := range rows {
+		res.Webhooks[i] = fromDBWebhook(row)
+	}
+	return res, nil
+}
+
+// DeleteWebhook removes a webhook with its deliveries, pending ones are
+// not attempted anymore.
+func (s *Service) DeleteWebhook(ctx context.Context, id int64) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteWebhook", trace.WithAttributes(attribute.Int64("webhook.id", id)))
+	defer func() { endSpan(span, err) }()
+	deleted, err := s.userRepo.DeleteWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns the deliveries of a webhook, newest first.
+func (s *Service) ListDeliveries(ctx context.Context, webhookID int64, params DeliveryParams) (_ *DeliveriesResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ListDeliveries", trace.WithAttributes(attribute.Int64("webhook.id", webhookID)))
+	defer func() { endSpan(span, err) }()
+	if params.Limit < 1 || params.Limit > MaxLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPagination, MaxLimit)
+	}
+	if params.Status != "" && !slices.Contains(deliveryStatuses, params.Status) {
+		return nil, fmt.Errorf("%w: status must be %s, %s or %s", ErrInvalidFilter, db.DeliveryPending, db.DeliveryDelivered, db.DeliveryDead)
+	}
+	query := db.ListWebhookDeliveriesParams{
+		WebhookID: webhookID,
+		Status:    pgtype.Text{String: params.Status, Valid: params.Status != ""},
+		RowLimit:  params.Limit + 1,
+	}
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.BeforeID = pgtype.Int8{Int64: c.ID, Valid: true}
+	}
+	rows, err := s.userRepo.ListWebhookDeliveries(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 && params.Cursor == "" {
+		if _, err := s.GetWebhook(ctx, webhookID); err != nil {
+			return nil, err
+		}
+	}
+	res := &DeliveriesResponse{}
+	if len(rows) > int(params.Limit) {
+		rows = rows[:params.Limit]
+		last := rows[len(rows)-1].WebhookDelivery
+		res.NextCursor = encodeCursor(cursor{ID: last.ID, CreatedAt: last.CreatedAt.Time})
+	}
+	res.Deliveries = make([]*Delivery, len(rows))
+	for i, row := range rows {
+		res.Deliveries[i] = fromDBDelivery(row.WebhookDelivery)
+		res.Deliveries[i].EventType = row.EventType
+	}
+	res.Count = len(rows)
+	return res, nil
+}
+
+// Redeliver makes a delivery pending again with a new round of attempts,
+// to resend a dead delivery or replay a delivered one.
+func (s *Service) Redeliver(ctx context.Context, webhookID, id int64) (_ *Delivery, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Redeliver", trace.WithAttributes(
+		attribute.Int64("webhook.id", webhookID),
+		attribute.Int64("delivery.id", id),
+	))
+	defer func() { endSpan(span, err) }()
+	row, err := s.userRepo.RedeliverWebhookDelivery(ctx, db.RedeliverWebhookDeliveryParams{WebhookID: webhookID, ID: id})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromDBDelivery(row), nil
+}
+
+func fromDBWebhook(row db.Webhook) *Webhook {
+	return &Webhook{
+		ID:         row.ID,
+		URL:        row.Url,
+		EventTypes: row.EventTypes,
+		CreatedAt:  row.CreatedAt.Time,
+	}
+}
+
+func fromDBDelivery(row db.WebhookDelivery) *Delivery {
+	d := &Delivery{
+		ID:        row.ID,
+		WebhookID: row.WebhookID,
+		EventID:   row.EventID,
+		Status:    row.Status,
+		Attempts:  row.Attempts,
+		LastError: row.LastError.String,
+		CreatedAt: row.CreatedAt.Time,
+	}
+	if row.LastStatusCode.Valid {
+		d.LastStatusCode = &row.LastStatusCode.Int32
+	}
+	if row.Status == db.DeliveryPending {
+		d.NextAttemptAt = &row.NextAttemptAt.Time
+	}
+	if row.DeliveredAt.Valid {
+		d.DeliveredAt = &row.DeliveredAt.Time
+	}
+	return d
+}
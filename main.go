@@ -2,38 +2,241 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/bmcszk/user-service/api"
+	"github.com/bmcszk/user-service/config"
 	"github.com/bmcszk/user-service/db"
 	"github.com/bmcszk/user-service/logic"
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/bmcszk/user-service/outbox"
+	"github.com/bmcszk/user-service/tracing"
 
 	"github.com/joho/godotenv"
 )
 
+// set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
 func main() {
 	// envs
 	err := godotenv.Load()
 	if err != nil {
 		slog.Info("No .env file provided")
 	}
-	postgresUrl := os.Getenv("POSTGRES_URL")
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		code := runImport(ctx, os.Args[2:])
+		stop()
+		os.Exit(code)
+	}
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(2)
+	}
+	logger, err := newLogger(cfg.Log)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	postgresUrl, err := cfg.DB.ConnString()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(2)
+	}
 	// ctx
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:       cfg.Tracing.Exporter,
+		Endpoint:       cfg.Tracing.Endpoint,
+		SampleRatio:    cfg.Tracing.SampleRatio,
+		ServiceName:    "user-service",
+		ServiceVersion: version,
+	})
+	if err != nil {
+		slog.Error(err.Error())
+		panic(err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error(err.Error())
+		}
+	}()
 	// db
-	conn, err := db.InitDB(ctx, postgresUrl)
+	pool, err := db.InitDB(ctx, postgresUrl, db.PoolConfig{
+		MaxConns:          cfg.DB.MaxConns,
+		MinConns:          cfg.DB.MinConns,
+		MaxConnIdleTime:   cfg.DB.MaxConnIdleTime,
+		MaxConnLifetime:   cfg.DB.MaxConnLifetime,
+		HealthCheckPeriod: cfg.DB.HealthCheckPeriod,
+	})
+	if err != nil {
+		slog.Error(err.Error())
+		panic(err)
+	}
+	defer pool.Close()
+	if err := metrics.RegisterPool(pool); err != nil {
+		slog.Error(err.Error())
+		panic(err)
+	}
+	queries := db.New(pool)
+	allowedNetworks, err := cfg.Webhooks.AllowedPrefixes()
 	if err != nil {
 		slog.Error(err.Error())
 		panic(err)
 	}
-	defer conn.Close(ctx)
-	queries := db.New(conn)
+	webhookPolicy := outbox.AddressPolicy{Allowed: allowedNetworks}
 	// logic
-	service := logic.NewService(queries)
+	serviceOpts := []logic.Option{
+		logic.WithBulkMaxRows(cfg.Server.BulkMaxRows),
+		logic.WithWebhookURLCheck(webhookPolicy.CheckURL),
+	}
+	if cfg.Server.RequireIfMatch {
+		serviceOpts = append(serviceOpts, logic.WithRequiredPrecondition())
+	}
+	service := logic.NewService(queries, serviceOpts...)
+	// events
+	stream := outbox.NewStream(queries)
+	streamDone := make(chan struct{})
+	go func() {
+		stream.Run(ctx)
+		close(streamDone)
+	}()
+	sequencerDone := make(chan struct{})
+	go func() {
+		outbox.NewSequencer(queries).Run(ctx)
+		close(sequencerDone)
+	}()
 	// api
-	http.ListenAndServe(":8080", api.NewHandler(service))
-	// TODO graceful shutdown
+	opts := []api.Option{
+		api.WithEventStream(stream),
+		api.WithReadinessChecks(
+			api.Check{Name: "db", Check: pool.Ping},
+			api.Check{Name: "schema", Check: func(ctx context.Context) error {
+				return db.CheckSchemaVersion(ctx, pool)
+			}},
+		),
+		api.WithBuildInfo(api.BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildTime: buildTime,
+			GoVersion: runtime.Version(),
+		}),
+	}
+	if cfg.Server.DebugPool {
+		opts = append(opts, api.WithPoolStats(pool))
+	}
+	if cfg.Server.ValidateRequests {
+		opts = append(opts, api.WithRequestValidation())
+	}
+	handler := api.NewHandler(service, opts...)
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// outbox
+	relayDone := make(chan struct{})
+	if publisher := newPublisher(cfg.Outbox); publisher != nil {
+		relay := outbox.NewRelay(queries, publisher, outbox.Config{
+			BatchSize:    cfg.Outbox.BatchSize,
+			PollInterval: cfg.Outbox.PollInterval,
+			MaxBackoff:   cfg.Outbox.MaxBackoff,
+			Timeout:      cfg.Outbox.Timeout,
+		})
+		go func() {
+			relay.Run(ctx)
+			close(relayDone)
+		}()
+	} else {
+		close(relayDone)
+	}
+	// webhooks
+	dispatcher := outbox.NewDispatcher(queries, webhookPolicy.Client(cfg.Webhooks.Timeout), outbox.Config{
+		BatchSize:    cfg.Webhooks.BatchSize,
+		PollInterval: cfg.Webhooks.PollInterval,
+		MaxBackoff:   cfg.Webhooks.MaxBackoff,
+		Timeout:      cfg.Webhooks.Timeout,
+	}, cfg.Webhooks.MaxAttempts)
+	dispatcherDone := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(dispatcherDone)
+	}()
+	if err := serve(ctx, server, cfg.Server.ShutdownTimeout); err != nil {
+		slog.Error(err.Error())
+	}
+	stop()
+	<-relayDone
+	<-dispatcherDone
+	<-streamDone
+	<-sequencerDone
+}
+
+// newPublisher returns the configured user events publisher, nil for none.
+func newPublisher(c config.Outbox) outbox.Publisher {
+	switch c.Publisher {
+	case outbox.PublisherLog:
+		return outbox.LogPublisher{}
+	case outbox.PublisherHTTP:
+		return outbox.HTTPPublisher{URL: c.URL, Client: &http.Client{Timeout: c.Timeout}}
+	}
+	return nil
+}
+
+func newLogger(c config.Log) (*slog.Logger, error) {
+	level, err := c.SlogLevel()
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, opts)), nil
+}
+
+// serve runs the server until ctx is done and then waits up to
+// shutdownTimeout for in-flight requests to finish.
+func serve(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("server started", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down server", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+	slog.Info("server stopped")
+	return nil
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_serve_ShutsDownOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:    "127.0.0.1:0",
+		Handler: http.NotFoundHandler(),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, server, time.Second)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return after cancel")
+	}
+}
+
+func Test_parseImportArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		givenArgs      []string
+		expectedFile   string
+		expectedFormat string
+		expectedErr    bool
+	}{
+		{
+			name:           "format from extension",
+			givenArgs:      []string{"-dry-run", "users.csv"},
+			expectedFile:   "users.csv",
+			expectedFormat: "csv",
+		},
+		{
+			name:           "format flag",
+			givenArgs:      []string{"-format", "ndjson", "-"},
+			expectedFile:   "-",
+			expectedFormat: "ndjson",
+		},
+		{
+			name:        "no file",
+			givenArgs:   []string{"-dry-run"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid mapping",
+			givenArgs:   []string{"-mapping", "name", "users.csv"},
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImportArgs(tt.givenArgs, io.Discard)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("parseImportArgs() error = %v, expectedErr %v", err, tt.expectedErr)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if got.file != tt.expectedFile || got.params.Format != tt.expectedFormat {
+				t.Errorf("parseImportArgs() = %+v", got)
+			}
+		})
+	}
+}
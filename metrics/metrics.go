@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "user_service"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route pattern and status code.",
+	}, []string{"route", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and status code.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .075, .1, .25, .5, 1, 2.5},
+	}, []string{"route", "code"})
+	logicErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logic_errors_total",
+		Help:      "Number of business logic errors by error.",
+	}, []string{"error"})
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "DB query latency by sqlc query name and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query", "result"})
+	outboxEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_total",
+		Help:      "Number of attempts to publish outbox events by event type and result.",
+	}, []string{"type", "result"})
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of attempts to deliver events to webhooks by event type and result.",
+	}, []string{"type", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		logicErrors,
+		dbQueryDuration,
+		outboxEvents,
+		webhookDeliveries,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a request labelled with the ServeMux route pattern.
+func ObserveRequest(route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, code).Inc()
+	httpDuration.WithLabelValues(route, code).Observe(duration.Seconds())
+}
+
+func LogicError(name string) {
+	logicErrors.WithLabelValues(name).Inc()
+}
+
+func ObserveQuery(name string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	dbQueryDuration.WithLabelValues(name, result).Observe(duration.Seconds())
+}
+
+// OutboxEvent records an attempt to publish an outbox event.
+func OutboxEvent(eventType, result string) {
+	outboxEvents.WithLabelValues(eventType, result).Inc()
+}
+
+// WebhookDelivery records an attempt to deliver an event to a webhook.
+func WebhookDelivery(eventType, result string) {
+	webhookDeliveries.WithLabelValues(eventType, result).Inc()
+}
+
+// RegisterPool exposes pool statistics as gauges and counters collected
+// on every scrape.
+func RegisterPool(pool *pgxpool.Pool) error {
+	return registry.Register(&poolCollector{pool: pool})
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("GET /test/{id}", http.StatusTeapot, time.Millisecond)
+	ObserveRequest("GET /test/{id}", http.StatusTeapot, time.Millisecond)
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET /test/{id}", "418")); got != 2 {
+		t.Errorf("requests for route = %v, want %v", got, 2)
+	}
+}
+
+func TestObserveQuery(t *testing.T) {
+	ObserveQuery("GetUser", time.Millisecond, nil)
+	ObserveQuery("GetUser", time.Millisecond, errors.New("conn closed"))
+
+	if got := testutil.CollectAndCount(dbQueryDuration, namespace+"_db_query_duration_seconds"); got != 2 {
+		t.Errorf("query duration series = %v, want %v", got, 2)
+	}
+}
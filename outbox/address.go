@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrAddressNotAllowed fails webhook urls and connections to addresses
+// that are not public, unless allowed.
+var ErrAddressNotAllowed = errors.New("address not allowed")
+
+// reserved are special purpose networks not caught by the netip.Addr
+// predicates: this network, shared address space of carrier-grade NAT,
+// IETF protocol assignments, benchmarking, reserved and NAT64.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// AddressPolicy tells which addresses webhooks may be delivered to, so
+// that they cannot reach the internal network: public unicast addresses,
+// not loopback, private, link-local or reserved, and those in Allowed.
+type AddressPolicy struct {
+	Allowed []netip.Prefix
+}
+
+// Allows tells whether webhooks may be delivered to addr.
+func (p AddressPolicy) Allows(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.Allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of a webhook url and fails with
+// ErrAddressNotAllowed when any of its addresses is not allowed.
+func (p AddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !p.Allows(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrAddressNotAllowed, host, addr)
+		}
+	}
+	return nil
+}
+
+// Client returns an http client for webhooks that connects only to allowed
+// addresses. The address is checked when dialing, after resolution, so a
+// host resolving differently than when checked is still refused, as is a
+// redirect to a disallowed address. Proxies are not used.
+func (p AddressPolicy) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+func (p AddressPolicy) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !p.Allows(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addrPort.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAddressPolicy_Allows(t *testing.T) {
+	policy := AddressPolicy{Allowed: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}}
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"10.1.2.3", true},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"::ffff:169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if allowed := policy.Allows(netip.MustParseAddr(tt.addr)); allowed != tt.allowed {
+				t.Errorf("Allows(%s) = %v, want %v", tt.addr, allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestAddressPolicy_CheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := AddressPolicy{}.CheckURL(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Errorf("CheckURL() error = %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrAddressNotAllowed) {
+				t.Errorf("CheckURL() error = %v, want %v", err, ErrAddressNotAllowed)
+			}
+		})
+	}
+}
+
+func TestAddressPolicy_Client(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := AddressPolicy{}.Client(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("Get() error = %v, want %v", err, ErrAddressNotAllowed)
+	}
+
+	policy := AddressPolicy{Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+	res, err := policy.Client(time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+const (
+	PublisherNone = "none"
+	PublisherLog  = "log"
+	PublisherHTTP = "http"
+)
+
+// Event is a change of a user. Payload is the user row after the change,
+// with deleted_at set for user.deleted, or before it for user.purged.
+// Attempts counts earlier attempts to deliver it. An event may be
+// delivered more than once, consumers deduplicate by ID. Position orders
+// streamed events, it is zero until assigned after commit.
+type Event struct {
+	ID        int64           `json:"id"`
+	Position  int64           `json:"-"`
+	Type      string          `json:"type"`
+	UserID    int64           `json:"user_id"`
+	Payload   json.RawMessage `json:"payload"`
+	RequestID string          `json:"request_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int32           `json:"attempts"`
+}
+
+// Publisher delivers events. An error makes the relay retry the event
+// later, holding back later events of the same user.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+func fromDB(row db.Outbox) Event {
+	return Event{
+		ID:        row.ID,
+		Position:  row.Position.Int64,
+		Type:      row.EventType,
+		UserID:    row.UserID,
+		Payload:   row.Payload,
+		RequestID: row.RequestID.String,
+		CreatedAt: row.CreatedAt.Time,
+		Attempts:  row.Attempts,
+	}
+}
+
+// LogPublisher writes events to a logger, the default one when nil.
+type LogPublisher struct {
+	Logger *slog.Logger
+}
+
+func (p LogPublisher) Publish(ctx context.Context, event Event) error {
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.InfoContext(ctx, "event published",
+		"event_id", event.ID,
+		"event_type", event.Type,
+		"user_id", event.UserID,
+		"request_id", event.RequestID,
+	)
+	return nil
+}
+
+// HTTPPublisher posts each event as JSON to URL with its ID in the
+// Idempotency-Key header. Any status other than 2xx fails the event.
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p HTTPPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = post(ctx, p.Client, p.URL, body, http.Header{
+		"Idempotency-Key": {strconv.FormatInt(event.ID, 10)},
+	})
+	if err != nil {
+		return fmt.Errorf("publishing event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// post sends a JSON body and returns the response status code, failing
+// unless it is 2xx.
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// MemoryPublisher keeps published events, for tests. It fails with Err
+// when set.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	Err    error
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns the events published so far.
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+// fakeStore claims its events, recording the lease and the outcomes.
+type fakeStore struct {
+	events    []db.Outbox
+	lease     time.Duration
+	mu        sync.Mutex
+	published []int64
+	retries   map[int64]time.Duration
+}
+
+func (s *fakeStore) ClaimOutboxEvents(ctx context.Context, arg db.ClaimOutboxEventsParams) ([]db.Outbox, error) {
+	s.lease = time.Duration(arg.LeaseSeconds * float64(time.Second))
+	return s.events, nil
+}
+
+func (s *fakeStore) MarkOutboxPublished(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, id)
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxFailed(ctx context.Context, arg db.MarkOutboxFailedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries[arg.ID] = time.Duration(arg.RetryAfterSeconds * float64(time.Second))
+	return nil
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	events := []db.Outbox{
+		{ID: 1, UserID: 10, EventType: db.EventUserCreated, Payload: []byte(`{"id":10}`)},
+		{ID: 2, UserID: 11, EventType: db.EventUserDeleted, Payload: []byte(`{"id":11}`), Attempts: 3},
+	}
+	tests := []struct {
+		name          string
+		publishErr    error
+		wantPublished int
+		wantRetries   map[int64]time.Duration
+	}{
+		{"published", nil, 2, map[int64]time.Duration{}},
+		{"failed", errors.New("unavailable"), 0, map[int64]time.Duration{1: time.Second, 2: 8 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{events: events, retries: map[int64]time.Duration{}}
+			publisher := &MemoryPublisher{Err: tt.publishErr}
+			relay := NewRelay(store, publisher, Config{BatchSize: 10, PollInterval: time.Second, MaxBackoff: time.Minute, Timeout: time.Second})
+
+			claimed, err := relay.RelayOnce(context.Background())
+
+			if err != nil {
+				t.Fatalf("RelayOnce() error = %v", err)
+			}
+			if claimed != len(events) {
+				t.Errorf("claimed = %d, want %d", claimed, len(events))
+			}
+			if want := time.Second + leaseMargin; store.lease != want {
+				t.Errorf("lease = %v, want %v", store.lease, want)
+			}
+			if got := len(publisher.Events()); got != tt.wantPublished {
+				t.Errorf("published events = %d, want %d", got, tt.wantPublished)
+			}
+			if len(store.published) != tt.wantPublished {
+				t.Errorf("marked published = %v, want %d", store.published, tt.wantPublished)
+			}
+			if len(store.retries) != len(tt.wantRetries) {
+				t.Fatalf("retries = %v, want %v", store.retries, tt.wantRetries)
+			}
+			for id, want := range tt.wantRetries {
+				if got := store.retries[id]; got != want {
+					t.Errorf("retry of event %d after %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_backoff(t *testing.T) {
+	config := Config{MaxBackoff: time.Minute}
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := config.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPPublisher_Publish(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"accepted", http.StatusAccepted, false},
+		{"server error", http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var key string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key = r.Header.Get("Idempotency-Key")
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			publisher := HTTPPublisher{URL: server.URL}
+
+			err := publisher.Publish(context.Background(), Event{ID: 42, Type: db.EventUserUpdated, Payload: []byte(`{}`)})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if key != "42" {
+				t.Errorf("Idempotency-Key = %q, want %q", key, "42")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// minBackoff is the delay before the first retry of a failed event.
+const minBackoff = time.Second
+
+// leaseMargin is how much longer than an attempt a claim is leased, to
+// mark the outcome of the attempt in time.
+const leaseMargin = 30 * time.Second
+
+type store interface {
+	ClaimOutboxEvents(ctx context.Context, arg db.ClaimOutboxEventsParams) ([]db.Outbox, error)
+	MarkOutboxPublished(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, arg db.MarkOutboxFailedParams) error
+}
+
+// Config tells how often and how much to poll, shared by Relay and
+// Dispatcher. Timeout limits each attempt.
+type Config struct {
+	BatchSize    int32
+	PollInterval time.Duration
+	MaxBackoff   time.Duration
+	Timeout      time.Duration
+}
+
+// Relay publishes events written to the outbox. Events are claimed with a
+// lease and published outside of any transaction, all events of a batch at
+// once, and then marked published. An event whose mark is lost is claimed
+// again when its lease expires, so it is delivered at least once. Events of
+// a user are published in order: a batch holds at most one per user, and a
+// failed event is retried with exponential backoff up to MaxBackoff and
+// holds back the later events of its user meanwhile. Several relays may run
+// at once.
+type Relay struct {
+	store     store
+	publisher Publisher
+	config    Config
+}
+
+func NewRelay(store store, publisher Publisher, config Config) *Relay {
+	return &Relay{store: store, publisher: publisher, config: config}
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	poll(ctx, "outbox relay", r.config, r.RelayOnce)
+}
+
+// RelayOnce publishes a batch of due events and returns how many were
+// claimed, whether published or failed.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	events, err := r.store.ClaimOutboxEvents(ctx, db.ClaimOutboxEventsParams{
+		LeaseSeconds: r.config.lease().Seconds(),
+		RowLimit:     r.config.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(events), concurrently(len(events), func(i int) error {
+		return r.relay(ctx, events[i])
+	})
+}
+
+// relay publishes a claimed event and marks the outcome.
+func (r *Relay) relay(ctx context.Context, row db.Outbox) error {
+	if err := r.publish(ctx, row); err != nil {
+		return r.store.MarkOutboxFailed(ctx, db.MarkOutboxFailedParams{
+			ID:                row.ID,
+			LastError:         pgtype.Text{String: err.Error(), Valid: true},
+			RetryAfterSeconds: r.config.backoff(row.Attempts + 1).Seconds(),
+		})
+	}
+	return r.store.MarkOutboxPublished(ctx, row.ID)
+}
+
+// concurrently calls fn with 0 to n-1 at once and joins the errors.
+func concurrently(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// poll runs once until ctx is done. It polls again right away after a full
+// batch and waits PollInterval otherwise.
+func poll(ctx context.Context, name string, config Config, once func(context.Context) (int, error)) {
+	slog.Info(name+" started", "poll_interval", config.PollInterval)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info(name + " stopped")
+			return
+		case <-timer.C:
+		}
+		claimed, err := once(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error(name+" failed", "error", err)
+		}
+		if err == nil && claimed == int(config.BatchSize) {
+			timer.Reset(0)
+		} else {
+			timer.Reset(config.PollInterval)
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, row db.Outbox) error {
+	event := fromDB(row)
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	if err := r.publisher.Publish(ctx, event); err != nil {
+		metrics.OutboxEvent(event.Type, "error")
+		slog.WarnContext(ctx, "publishing event failed",
+			"event_id", event.ID,
+			"event_type", event.Type,
+			"attempts", event.Attempts+1,
+			"error", err,
+		)
+		return err
+	}
+	metrics.OutboxEvent(event.Type, "ok")
+	return nil
+}
+
+// lease is how long claimed events or deliveries are held by one relay or
+// dispatcher.
+func (c Config) lease() time.Duration {
+	return c.Timeout + leaseMargin
+}
+
+// backoff doubles the delay with each failed attempt.
+func (c Config) backoff(attempts int32) time.Duration {
+	d := minBackoff
+	for i := int32(1); i < attempts && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, c.MaxBackoff)
+}
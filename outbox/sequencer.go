@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+const (
+	// sequenceBatch is how many events are positioned in one transaction.
+	sequenceBatch = 500
+	// sequenceInterval is how often events are positioned without being
+	// notified of them, e.g. those written while no instance sequenced.
+	sequenceInterval = 5 * time.Second
+	// sequencerRetry is how often an instance that is not the sequencer
+	// tries to become it.
+	sequencerRetry = 5 * time.Second
+)
+
+type sequencerStore interface {
+	SequenceEvents(ctx context.Context, limit int32, interval time.Duration) error
+}
+
+// Sequencer assigns positions to events committed to the outbox, ordering
+// the Stream. Every instance runs one, but only the one holding the lock in
+// Postgres sequences, the others take over when it stops.
+type Sequencer struct {
+	store sequencerStore
+}
+
+func NewSequencer(store sequencerStore) *Sequencer {
+	return &Sequencer{store: store}
+}
+
+// Run sequences events whenever this instance is the sequencer until ctx
+// is done.
+func (s *Sequencer) Run(ctx context.Context) {
+	for {
+		err := s.store.SequenceEvents(ctx, sequenceBatch, sequenceInterval)
+		if ctx.Err() != nil {
+			return
+		}
+		retry := sequencerRetry
+		if !errors.Is(err, db.ErrNotSequencer) {
+			slog.Error("sequencing events failed", "error", err)
+			retry = reconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
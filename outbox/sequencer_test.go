@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+// fakeSequencerStore is the sequencer once another instance stopped being
+// it, and sequences until ctx is done.
+type fakeSequencerStore struct {
+	calls      int
+	sequencing chan struct{}
+}
+
+func (s *fakeSequencerStore) SequenceEvents(ctx context.Context, limit int32, interval time.Duration) error {
+	s.calls++
+	if s.calls == 1 {
+		return db.ErrNotSequencer
+	}
+	close(s.sequencing)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSequencer_Run(t *testing.T) {
+	store := &fakeSequencerStore{sequencing: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewSequencer(store).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-store.sequencing:
+	case <-time.After(2 * sequencerRetry):
+		t.Fatal("sequencer not taken over")
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,175 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// streamBatch is how many events are read at once.
+const streamBatch = 500
+
+// reconnectDelay is the wait before listening again after the connection
+// failed.
+const reconnectDelay = time.Second
+
+// ErrStreamUnavailable is returned by Subscribe while the stream does not
+// listen to events.
+var ErrStreamUnavailable = errors.New("event stream unavailable")
+
+type eventStore interface {
+	ListenEvents(ctx context.Context, ready func() error, fn func()) error
+	GetLastOutboxPosition(ctx context.Context) (int64, error)
+	ListOutboxEventsAfter(ctx context.Context, arg db.ListOutboxEventsAfterParams) ([]db.Outbox, error)
+}
+
+// Stream fans out events written to the outbox by any instance to the
+// subscribers in this one, in position order, as Postgres notifies that
+// the Sequencer assigned them positions. Subscribers that could miss
+// events, because they lag behind or the stream stopped listening, are
+// dropped by closing their channel, and catch up with EventsAfter.
+type Stream struct {
+	store       eventStore
+	mu          sync.Mutex
+	listening   bool
+	subscribers map[chan Event]struct{}
+	// position is of the last event sent, only used by Run.
+	position int64
+}
+
+func NewStream(store eventStore) *Stream {
+	return &Stream{store: store, subscribers: make(map[chan Event]struct{})}
+}
+
+// Run listens to events until ctx is done and then drops all subscribers.
+func (s *Stream) Run(ctx context.Context) {
+	slog.Info("event stream started")
+	for {
+		err := s.store.ListenEvents(ctx, func() error {
+			return s.ready(ctx)
+		}, func() {
+			s.catchUp(ctx)
+		})
+		s.dropAll()
+		if ctx.Err() != nil {
+			slog.Info("event stream stopped")
+			return
+		}
+		slog.Error("listening to events failed", "error", err)
+		select {
+		case <-ctx.Done():
+			slog.Info("event stream stopped")
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// Subscribe returns a channel of events written from now on and a func to
+// unsubscribe. The channel is closed when the subscriber is dropped.
+func (s *Stream) Subscribe() (<-chan Event, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.listening {
+		return nil, nil, ErrStreamUnavailable
+	}
+	ch := make(chan Event, subscriberBuffer)
+	s.subscribers[ch] = struct{}{}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.drop(ch)
+	}, nil
+}
+
+// EventsAfter returns up to limit events with positions greater than
+// position in position order.
+func (s *Stream) EventsAfter(ctx context.Context, position int64, limit int32) ([]Event, error) {
+	rows, err := s.store.ListOutboxEventsAfter(ctx, db.ListOutboxEventsAfterParams{AfterPosition: position, RowLimit: limit})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(rows))
+	for i, row := range rows {
+		events[i] = fromDB(row)
+	}
+	return events, nil
+}
+
+// ready starts from the last position once listening, so that events
+// positioned from now on are sent, and takes subscribers.
+func (s *Stream) ready(ctx context.Context) error {
+	position, err := s.store.GetLastOutboxPosition(ctx)
+	if err != nil {
+		return err
+	}
+	s.position = position
+	s.mu.Lock()
+	s.listening = true
+	s.mu.Unlock()
+	s.catchUp(ctx)
+	return nil
+}
+
+// catchUp sends the events after the last one sent to every subscriber.
+// When events cannot be read all subscribers are dropped.
+func (s *Stream) catchUp(ctx context.Context) {
+	for {
+		rows, err := s.store.ListOutboxEventsAfter(ctx, db.ListOutboxEventsAfterParams{AfterPosition: s.position, RowLimit: streamBatch})
+		if err != nil {
+			slog.Error("reading events", "position", s.position, "error", err)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for ch := range s.subscribers {
+				s.drop(ch)
+			}
+			return
+		}
+		for _, row := range rows {
+			s.dispatch(fromDB(row))
+		}
+		if len(rows) < streamBatch {
+			return
+		}
+	}
+}
+
+// dispatch sends the event to every subscriber, dropping those that are
+// full.
+func (s *Stream) dispatch(event Event) {
+	s.position = event.Position
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.drop(ch)
+		}
+	}
+}
+
+func (s *Stream) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listening = false
+	for ch := range s.subscribers {
+		s.drop(ch)
+	}
+}
+
+// drop closes the channel of a subscriber. It must be called with mu held.
+func (s *Stream) drop(ch chan Event) {
+	if _, ok := s.subscribers[ch]; ok {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,175 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeEventStore notifies of events once listening, positioned in the
+// order they are committed like by the sequencer.
+type fakeEventStore struct {
+	listening chan struct{}
+	notify    chan struct{}
+	mu        sync.Mutex
+	events    []db.Outbox
+}
+
+func newFakeEventStore() *fakeEventStore {
+	return &fakeEventStore{listening: make(chan struct{}), notify: make(chan struct{})}
+}
+
+// commit writes an event, positions it and notifies of it.
+func (s *fakeEventStore) commit(id int64) {
+	s.mu.Lock()
+	s.events = append(s.events, db.Outbox{
+		ID:        id,
+		Position:  pgtype.Int8{Int64: int64(len(s.events) + 1), Valid: true},
+		UserID:    10,
+		EventType: db.EventUserUpdated,
+		Payload:   []byte(`{}`),
+	})
+	s.mu.Unlock()
+	s.notify <- struct{}{}
+}
+
+func (s *fakeEventStore) ListenEvents(ctx context.Context, ready func() error, fn func()) error {
+	if err := ready(); err != nil {
+		return err
+	}
+	close(s.listening)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.notify:
+			fn()
+		}
+	}
+}
+
+func (s *fakeEventStore) GetLastOutboxPosition(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var position int64
+	for _, event := range s.events {
+		position = max(position, event.Position.Int64)
+	}
+	return position, nil
+}
+
+func (s *fakeEventStore) ListOutboxEventsAfter(ctx context.Context, arg db.ListOutboxEventsAfterParams) ([]db.Outbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []db.Outbox
+	for _, event := range s.events {
+		if event.Position.Valid && event.Position.Int64 > arg.AfterPosition && len(events) < int(arg.RowLimit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// runStream runs a stream until the test ends and waits until it listens.
+func runStream(t *testing.T, store *fakeEventStore) *Stream {
+	stream := NewStream(store)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stream.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	<-store.listening
+	return stream
+}
+
+func TestStream(t *testing.T) {
+	store := newFakeEventStore()
+	stream := NewStream(store)
+	if _, _, err := stream.Subscribe(); !errors.Is(err, ErrStreamUnavailable) {
+		t.Fatalf("Subscribe() before listening error = %v, want %v", err, ErrStreamUnavailable)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stream.Run(ctx)
+		close(done)
+	}()
+	<-store.listening
+
+	events, unsubscribe, err := stream.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	slow, _, err := stream.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := int64(1); id <= subscriberBuffer+1; id++ {
+		store.commit(id)
+		if event := <-events; event.ID != id {
+			t.Fatalf("event = %d, want %d", event.ID, id)
+		}
+	}
+	if got := drain(slow); got != subscriberBuffer {
+		t.Errorf("slow subscriber received %d events before dropped, want %d", got, subscriberBuffer)
+	}
+
+	cancel()
+	<-done
+	if _, ok := <-events; ok {
+		t.Error("subscriber not dropped when stream stopped")
+	}
+}
+
+func TestStream_InterleavedCommits(t *testing.T) {
+	store := newFakeEventStore()
+	stream := runStream(t, store)
+	events, unsubscribe, err := stream.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	// The event with id 2 commits before the one with id 1.
+	store.commit(2)
+	received := <-events
+	store.commit(1)
+	<-events
+
+	missed, err := stream.EventsAfter(context.Background(), received.Position, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 1 || missed[0].ID != 1 {
+		t.Errorf("EventsAfter(%d) = %+v, want the event with id 1", received.Position, missed)
+	}
+}
+
+// drain reads a channel until it is closed and returns how many events it
+// held.
+func drain(ch <-chan Event) int {
+	n := 0
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return n
+			}
+			n++
+		case <-timeout:
+			return -1
+		}
+	}
+}
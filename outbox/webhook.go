@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+	"github.com/bmcszk/user-service/metrics"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Headers of a webhook delivery. The signature is the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed by the webhook secret.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+type deliveryStore interface {
+	ClaimWebhookDeliveries(ctx context.Context, arg db.ClaimWebhookDeliveriesParams) ([]db.ClaimWebhookDeliveriesRow, error)
+	MarkDeliveryDelivered(ctx context.Context, arg db.MarkDeliveryDeliveredParams) error
+	MarkDeliveryFailed(ctx context.Context, arg db.MarkDeliveryFailedParams) error
+}
+
+// Dispatcher delivers events to subscribed webhooks. Deliveries are
+// created with the events, so each webhook receives every event it
+// subscribes to at least once. Deliveries are claimed with a lease and
+// attempted at once, outside of any transaction, like in Relay, so a slow
+// webhook does not hold back the others. A failed delivery is retried with
+// exponential backoff up to MaxBackoff and is dead after maxAttempts,
+// until redelivered. Several dispatchers may run at once.
+type Dispatcher struct {
+	store       deliveryStore
+	client      *http.Client
+	config      Config
+	maxAttempts int32
+}
+
+func NewDispatcher(store deliveryStore, client *http.Client, config Config, maxAttempts int32) *Dispatcher {
+	return &Dispatcher{store: store, client: client, config: config, maxAttempts: maxAttempts}
+}
+
+// Run delivers events until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll(ctx, "webhook dispatcher", d.config, d.DeliverOnce)
+}
+
+// DeliverOnce attempts a batch of due deliveries and returns how many were
+// claimed, whether delivered or failed.
+func (d *Dispatcher) DeliverOnce(ctx context.Context) (int, error) {
+	rows, err := d.store.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+		LeaseSeconds: d.config.lease().Seconds(),
+		RowLimit:     d.config.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), concurrently(len(rows), func(i int) error {
+		return d.dispatch(ctx, rows[i])
+	})
+}
+
+// dispatch attempts a claimed delivery and marks the outcome. A status code
+// is recorded only when there was a response.
+func (d *Dispatcher) dispatch(ctx context.Context, row db.ClaimWebhookDeliveriesRow) error {
+	delivery := row.WebhookDelivery
+	statusCode, err := d.deliver(ctx, row)
+	status := pgtype.Int4{Int32: statusCode, Valid: statusCode != 0}
+	if err != nil {
+		return d.store.MarkDeliveryFailed(ctx, db.MarkDeliveryFailedParams{
+			ID:                delivery.ID,
+			MaxAttempts:       d.maxAttempts,
+			StatusCode:        status,
+			LastError:         pgtype.Text{String: err.Error(), Valid: true},
+			RetryAfterSeconds: d.config.backoff(delivery.Attempts + 1).Seconds(),
+		})
+	}
+	return d.store.MarkDeliveryDelivered(ctx, db.MarkDeliveryDeliveredParams{
+		ID:         delivery.ID,
+		StatusCode: status,
+	})
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, row db.ClaimWebhookDeliveriesRow) (int32, error) {
+	delivery := row.WebhookDelivery
+	event := fromDB(row.Outbox)
+	event.Attempts = delivery.Attempts
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+	statusCode, err := post(ctx, d.client, row.Url, body, http.Header{
+		SignatureHeader:   {Sign(row.Secret, timestamp, body)},
+		TimestampHeader:   {timestamp},
+		DeliveryHeader:    {strconv.FormatInt(delivery.ID, 10)},
+		"Idempotency-Key": {strconv.FormatInt(event.ID, 10)},
+	})
+	if err != nil {
+		metrics.WebhookDelivery(event.Type, "error")
+		slog.WarnContext(ctx, "webhook delivery failed",
+			"webhook_id", delivery.WebhookID,
+			"delivery_id", delivery.ID,
+			"event_id", event.ID,
+			"attempts", delivery.Attempts+1,
+			"error", err,
+		)
+		return int32(statusCode), err
+	}
+	metrics.WebhookDelivery(event.Type, "ok")
+	return int32(statusCode), nil
+}
+
+// Sign returns the signature of a webhook body sent at timestamp, as in
+// the SignatureHeader.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
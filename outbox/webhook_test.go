@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmcszk/user-service/db"
+)
+
+// fakeDeliveryStore claims its deliveries, recording the outcomes.
+type fakeDeliveryStore struct {
+	rows        []db.ClaimWebhookDeliveriesRow
+	mu          sync.Mutex
+	statusCodes map[int64]int32
+	delivered   map[int64]bool
+}
+
+func newFakeDeliveryStore(rows ...db.ClaimWebhookDeliveriesRow) *fakeDeliveryStore {
+	return &fakeDeliveryStore{rows: rows, statusCodes: map[int64]int32{}, delivered: map[int64]bool{}}
+}
+
+func (s *fakeDeliveryStore) ClaimWebhookDeliveries(ctx context.Context, arg db.ClaimWebhookDeliveriesParams) ([]db.ClaimWebhookDeliveriesRow, error) {
+	return s.rows, nil
+}
+
+func (s *fakeDeliveryStore) MarkDeliveryDelivered(ctx context.Context, arg db.MarkDeliveryDeliveredParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCodes[arg.ID], s.delivered[arg.ID] = arg.StatusCode.Int32, true
+	return nil
+}
+
+func (s *fakeDeliveryStore) MarkDeliveryFailed(ctx context.Context, arg db.MarkDeliveryFailedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCodes[arg.ID], s.delivered[arg.ID] = arg.StatusCode.Int32, false
+	return nil
+}
+
+func deliveryTo(id int64, url string) db.ClaimWebhookDeliveriesRow {
+	return db.ClaimWebhookDeliveriesRow{
+		WebhookDelivery: db.WebhookDelivery{ID: id, WebhookID: 3, EventID: 42},
+		Url:             url,
+		Secret:          "0123456789abcdef",
+		Outbox:          db.Outbox{ID: 42, UserID: 10, EventType: db.EventUserUpdated, Payload: []byte(`{"id":10}`)},
+	}
+}
+
+func TestDispatcher_DeliverOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantDelivered bool
+	}{
+		{"delivered", http.StatusNoContent, true},
+		{"rejected", http.StatusGone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			store := newFakeDeliveryStore(deliveryTo(7, server.URL))
+			dispatcher := NewDispatcher(store, server.Client(), Config{BatchSize: 10, MaxBackoff: time.Minute, Timeout: time.Second}, 5)
+
+			claimed, err := dispatcher.DeliverOnce(context.Background())
+
+			if err != nil || claimed != 1 {
+				t.Fatalf("DeliverOnce() = %d, %v", claimed, err)
+			}
+			if got := store.statusCodes[7]; got != int32(tt.status) {
+				t.Errorf("status code = %d, want %d", got, tt.status)
+			}
+			if store.delivered[7] != tt.wantDelivered {
+				t.Errorf("delivered = %v, want %v", store.delivered[7], tt.wantDelivered)
+			}
+			if want := Sign("0123456789abcdef", header.Get(TimestampHeader), body); header.Get(SignatureHeader) != want {
+				t.Errorf("signature = %q, want %q", header.Get(SignatureHeader), want)
+			}
+			if header.Get(DeliveryHeader) != "7" {
+				t.Errorf("delivery header = %q, want %q", header.Get(DeliveryHeader), "7")
+			}
+		})
+	}
+}
+
+func TestDispatcher_DeliverOnce_SlowWebhook(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	var fastAt time.Time
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastAt = time.Now()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+	store := newFakeDeliveryStore(deliveryTo(1, slow.URL), deliveryTo(2, fast.URL))
+	timeout := 200 * time.Millisecond
+	dispatcher := NewDispatcher(store, http.DefaultClient, Config{BatchSize: 10, MaxBackoff: time.Minute, Timeout: timeout}, 5)
+	start := time.Now()
+
+	if _, err := dispatcher.DeliverOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.delivered[1] || !store.delivered[2] {
+		t.Errorf("delivered = %v, want only 2", store.delivered)
+	}
+	if fastAt.Sub(start) >= timeout {
+		t.Errorf("fast webhook held back by the slow one for %v", fastAt.Sub(start))
+	}
+}